@@ -1,2 +1,2 @@
 #!/bin/sh
-exec /usr/bin/rbn-to-kinesis ${STREAM} ${DB_HOST_PORT} ${DB_USER}
+exec /usr/bin/rbn-to-kinesis --stream=${STREAM} --db-host-port=${DB_HOST_PORT} --db-user=${DB_USER} "$@"
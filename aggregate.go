@@ -0,0 +1,154 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DxHeardSchema - Avro schema of the events emitted by the Aggregator.
+const DxHeardSchema = `{
+	    "type": "record",
+	    "name": "dx_heard",
+	    "fields" : [
+	        {"name": "dx", "type": "string"},
+	        {"name": "dx_pfx", "type": "string"},
+	        {"name": "dx_cont", "type": "string"},
+	        {"name": "band", "type": "string"},
+	        {"name": "mode", "type": "string"},
+	        {"name": "freq", "type": "double"},
+	        {"name": "skimmers", "type": "int"},
+	        {"name": "min_db", "type": "int"},
+	        {"name": "max_db", "type": "int"},
+	        {"name": "avg_db", "type": "double"},
+	        {"name": "first_seen", "type": "long"},
+	        {"name": "last_seen", "type": "long"},
+	        {"name": "de_calls", "type": {"type": "array", "items": "string"}}
+	    ]
+	}`
+
+// Aggregator collapses the spots of the same DX and mode within FreqTolerance kHz into a single
+// dx_heard event once Window has passed since the DX was first heard.
+type Aggregator struct {
+	Window        time.Duration
+	FreqTolerance float64
+	mu            sync.Mutex
+	open          map[string][]*heardGroup // by heardKey, one group per frequency the DX is heard on
+	opened        int
+}
+
+type heardGroup struct {
+	record  map[string]interface{} // first spot of the group
+	freqSum float64
+	dbSum   int
+	minDB   int
+	maxDB   int
+	spots   int
+	first   time.Time
+	last    time.Time
+	calls   map[string]struct{}
+	seq     int // order the group was opened in
+}
+
+// NewAggregator creates an aggregator.
+func NewAggregator(window time.Duration, freqTolerance float64) *Aggregator {
+	return &Aggregator{Window: window, FreqTolerance: freqTolerance, open: make(map[string][]*heardGroup)}
+}
+
+func heardKey(dx, mode string) string {
+	return dx + "|" + mode
+}
+
+// Add folds a decorated spot received at time at into the open group for its DX.
+func (a *Aggregator) Add(record map[string]interface{}, at time.Time) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	dx, _ := record["dx"].(string)
+	mode, _ := record["mode"].(string)
+	freq, _ := record["freq"].(float64)
+	db, _ := record["db"].(int)
+	call, _ := record["callsign"].(string)
+
+	key := heardKey(dx, mode)
+	var g *heardGroup
+	for _, o := range a.open[key] {
+		if math.Abs(o.record["freq"].(float64)-freq) <= a.FreqTolerance {
+			g = o
+			break
+		}
+	}
+	if g == nil {
+		a.opened++
+		g = &heardGroup{record: record, minDB: db, maxDB: db, first: at, calls: make(map[string]struct{}), seq: a.opened}
+		a.open[key] = append(a.open[key], g)
+	}
+	g.spots++
+	g.freqSum += freq
+	g.dbSum += db
+	if db < g.minDB {
+		g.minDB = db
+	}
+	if db > g.maxDB {
+		g.maxDB = db
+	}
+	if at.After(g.last) {
+		g.last = at
+	}
+	g.calls[call] = struct{}{}
+}
+
+// Flush returns the dx_heard events of the groups whose window has closed as of now, in the order
+// the groups were opened.
+func (a *Aggregator) Flush(now time.Time) []map[string]interface{} {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var closed []*heardGroup
+	for key, groups := range a.open {
+		open := groups[:0]
+		for _, g := range groups {
+			if now.Sub(g.first) < a.Window {
+				open = append(open, g)
+				continue
+			}
+			closed = append(closed, g)
+		}
+		if len(open) == 0 {
+			delete(a.open, key)
+		} else {
+			a.open[key] = open
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool { return closed[i].seq < closed[j].seq })
+	events := make([]map[string]interface{}, 0, len(closed))
+	for _, g := range closed {
+		events = append(events, g.event())
+	}
+	return events
+}
+
+func (g *heardGroup) event() map[string]interface{} {
+
+	calls := make([]string, 0, len(g.calls))
+	for c := range g.calls {
+		calls = append(calls, c)
+	}
+	sort.Strings(calls)
+	return map[string]interface{}{
+		"dx":         g.record["dx"],
+		"dx_pfx":     g.record["dx_pfx"],
+		"dx_cont":    g.record["dx_cont"],
+		"band":       g.record["band"],
+		"mode":       g.record["mode"],
+		"freq":       g.freqSum / float64(g.spots),
+		"skimmers":   len(calls),
+		"min_db":     g.minDB,
+		"max_db":     g.maxDB,
+		"avg_db":     float64(g.dbSum) / float64(g.spots),
+		"first_seen": g.first.UnixNano() / int64(time.Millisecond),
+		"last_seen":  g.last.UnixNano() / int64(time.Millisecond),
+		"de_calls":   calls,
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func heardSpot(skimmer, dx string, freq float64, db int) map[string]interface{} {
+	return map[string]interface{}{"callsign": skimmer, "dx": dx, "dx_pfx": "K", "dx_cont": "NA", "band": "20m",
+		"mode": "CW", "freq": freq, "db": db}
+}
+
+func TestAggregator(t *testing.T) {
+
+	t0 := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := NewAggregator(time.Minute, 0.5)
+	a.Add(heardSpot("DK9IP", "K1ABC", 14025.0, 10), t0)
+	a.Add(heardSpot("W3LPL", "K1ABC", 14025.4, 22), t0.Add(10*time.Second))
+	a.Add(heardSpot("DK9IP", "K1ABC", 14025.2, 15), t0.Add(20*time.Second))
+	// Outside the frequency tolerance, another mode and another DX each get their own group
+	a.Add(heardSpot("DK9IP", "K1ABC", 14026.0, 30), t0.Add(5*time.Second))
+	rtty := heardSpot("DK9IP", "K1ABC", 14025.0, 12)
+	rtty["mode"] = "RTTY"
+	a.Add(rtty, t0.Add(5*time.Second))
+	a.Add(heardSpot("DK9IP", "W6XYZ", 14025.0, 8), t0.Add(30*time.Second))
+
+	// Nothing until a minute after the DX was first heard
+	if events := a.Flush(t0.Add(time.Minute - time.Millisecond)); len(events) != 0 {
+		t.Errorf("Expected no events before the window closed, got %v", events)
+	}
+	events := a.Flush(t0.Add(time.Minute))
+	if len(events) != 1 {
+		t.Fatalf("Expected the first group at the window boundary, got %v", events)
+	}
+	want := map[string]interface{}{"dx": "K1ABC", "dx_pfx": "K", "dx_cont": "NA", "band": "20m", "mode": "CW",
+		"freq": 14025.2, "skimmers": 2, "min_db": 10, "max_db": 22, "avg_db": 47.0 / 3,
+		"first_seen": t0.UnixNano() / int64(time.Millisecond),
+		"last_seen":  t0.Add(20*time.Second).UnixNano() / int64(time.Millisecond),
+		"de_calls":   []string{"DK9IP", "W3LPL"}}
+	for k, v := range want {
+		got := events[0][k]
+		if f, ok := v.(float64); ok {
+			if g, _ := got.(float64); g-f > 1e-9 || f-g > 1e-9 {
+				t.Errorf("%s: expected %v, got %v", k, v, got)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", k, v, v, got, got)
+		}
+	}
+
+	if events = a.Flush(t0.Add(65 * time.Second)); len(events) != 2 {
+		t.Errorf("Expected the other frequency and mode, got %v", events)
+	}
+	// A later spot of a flushed DX starts a new window
+	a.Add(heardSpot("KM3T", "K1ABC", 14025.0, 5), t0.Add(70*time.Second))
+	events = a.Flush(t0.Add(90 * time.Second))
+	if len(events) != 1 || events[0]["dx"] != "W6XYZ" {
+		t.Errorf("Expected W6XYZ, got %v", events)
+	}
+	events = a.Flush(t0.Add(130 * time.Second))
+	if len(events) != 1 || events[0]["skimmers"] != 1 || !reflect.DeepEqual(events[0]["de_calls"], []string{"KM3T"}) {
+		t.Errorf("Expected a new K1ABC group, got %v", events)
+	}
+	if events = a.Flush(t0.Add(time.Hour)); len(events) != 0 {
+		t.Errorf("Expected nothing left, got %v", events)
+	}
+}
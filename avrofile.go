@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// NewAvroFileSink writes records as Avro Object Container Files under dir, one directory per day
+// (date=YYYY-MM-DD/).  Files embed the record schema so Spark or DuckDB can read them directly, are
+// compressed with codec (deflate, snappy or zstd) and roll every roll interval of spot time or at
+// maxBytes.
+func NewAvroFileSink(dir, codec string, roll time.Duration, maxBytes int64) (*FileSink, error) {
+
+	if _, err := ocfCodec(codec); err != nil {
+		return nil, err
+	}
+	sink, err := NewFileSink(dir, FormatAvro, maxBytes, roll, dayPartition)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create avro sink: %v", err)
+	}
+	sink.Codec = codec
+	return sink, nil
+}
+
+// date=YYYY-MM-DD
+func dayPartition(name string, record map[string]interface{}, at time.Time) string {
+	return "date=" + at.Format("2006-01-02")
+}
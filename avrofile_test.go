@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro"
+	"github.com/hamba/avro/ocf"
+	"github.com/klauspost/compress/zstd"
+)
+
+func avroFiles(t *testing.T, dir string) []string {
+
+	var files []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && filepath.Ext(path) == ".avro" && !strings.HasPrefix(info.Name(), ".") {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, rel)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+// readOCF decodes an Object Container File with the hamba ocf reader, returning its codec and records.
+func readOCF(t *testing.T, path string) (string, []map[string]interface{}) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dec, err := ocf.NewDecoder(f)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	var records []map[string]interface{}
+	for dec.HasNext() {
+		var rec map[string]interface{}
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	if err := dec.Error(); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return string(dec.Metadata()["avro.codec"]), records
+}
+
+// readZstdOCF decodes a zstandard compressed Object Container File by hand, the hamba ocf reader has
+// no zstandard codec.
+func readZstdOCF(t *testing.T, path string) (string, []map[string]interface{}) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "Obj\x01" {
+		t.Fatalf("%s: bad magic %q", path, magic)
+	}
+	readLong := func() int64 {
+		v, err := binary.ReadVarint(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	readBytes := func() []byte {
+		b := make([]byte, readLong())
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	meta := make(map[string]string)
+	for n := readLong(); n != 0; n = readLong() {
+		for i := int64(0); i < n; i++ {
+			k := readBytes()
+			meta[string(k)] = string(readBytes())
+		}
+	}
+	schema := avro.MustParse(meta["avro.schema"])
+	sync := make([]byte, 16)
+	io.ReadFull(r, sync)
+
+	var records []map[string]interface{}
+	for {
+		count, err := binary.ReadVarint(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		data := readBytes()
+		if meta["avro.codec"] != "zstandard" {
+			t.Fatalf("%s: expected zstandard, got %s", path, meta["avro.codec"])
+		}
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(nil); err == nil {
+			data, err = zr.DecodeAll(data, nil)
+			zr.Close()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec := avro.NewDecoderForSchema(schema, bytes.NewReader(data))
+		for i := int64(0); i < count; i++ {
+			var rec map[string]interface{}
+			if err := dec.Decode(&rec); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, rec)
+		}
+		marker := make([]byte, 16)
+		if _, err := io.ReadFull(r, marker); err != nil || !bytes.Equal(marker, sync) {
+			t.Fatalf("%s: bad sync marker", path)
+		}
+	}
+	return meta["avro.codec"], records
+}
+
+func TestAvroFileSink(t *testing.T) {
+
+	schema := avro.MustParse(SpotSchema)
+	at := time.Date(2021, 10, 13, 23, 30, 0, 0, time.UTC)
+	for codec, want := range map[string]string{"null": "null", "deflate": "deflate", "snappy": "snappy",
+		"zstd": "zstandard"} {
+		t.Run(codec, func(t *testing.T) {
+			dir := t.TempDir()
+			sink, err := NewAvroFileSink(dir, codec, time.Hour, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, dx := range []string{"K1ABC", "K1ABD", "K1ABE"} {
+				ts := at.Add(time.Duration(i) * 20 * time.Minute)
+				if err := sink.Publish(schema, testSpot(dx, "20m", 14025.1, ts), ts); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// 23:30 and 23:50 in one file, 00:10 rolls into the next day
+			files := avroFiles(t, dir)
+			if len(files) != 2 {
+				t.Fatalf("Expected 2 files, got %v", files)
+			}
+			if d := filepath.Dir(files[0]); d != "date=2021-10-13" {
+				t.Errorf("Unexpected partition %s", d)
+			}
+			if d := filepath.Dir(files[1]); d != "date=2021-10-14" {
+				t.Errorf("Unexpected partition %s", d)
+			}
+			read := readOCF
+			if want == "zstandard" {
+				read = readZstdOCF
+			}
+			got, records := read(t, filepath.Join(dir, files[0]))
+			if got != want {
+				t.Errorf("Expected codec %s, got %s", want, got)
+			}
+			if len(records) != 2 || records[0]["dx"] != "K1ABC" || records[1]["dx"] != "K1ABD" {
+				t.Errorf("Unexpected records %v", records)
+			}
+		})
+	}
+}
+
+func TestAvroFileSinkMaxBytes(t *testing.T) {
+
+	schema := avro.MustParse(SpotSchema)
+	dir := t.TempDir()
+	sink, err := NewAvroFileSink(dir, "deflate", time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2021, 10, 13, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		ts := at.Add(time.Duration(i) * time.Second)
+		if err := sink.Publish(schema, testSpot("K1ABC", "20m", 14025.1, ts), ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink.Close()
+	if files := avroFiles(t, dir); len(files) != 3 {
+		t.Errorf("Expected a file per record, got %v", files)
+	}
+}
+
+func TestAvroFileSinkCodec(t *testing.T) {
+
+	if _, err := NewAvroFileSink(t.TempDir(), "lz4", time.Hour, 0); err == nil {
+		t.Error("Expected an error for an unknown codec")
+	}
+}
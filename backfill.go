@@ -0,0 +1,331 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RBNArchiveURL - Daily raw data files published by reversebeacon.net.
+const RBNArchiveURL = "https://www.reversebeacon.net/raw_data/dl.php?f={date}"
+
+// Rows imported between progress saves.  Each save finishes the open output files, so it's kept
+// large enough not to litter the sinks with small files.
+var progressInterval = 100000
+
+// Archive - RBN raw data archive, either a local directory holding YYYYMMDD.zip or YYYYMMDD.csv
+// files or a URL.  A URL containing {date} has it replaced by YYYYMMDD, otherwise /YYYYMMDD.zip is
+// appended.
+type Archive struct {
+	Source string
+	Client *http.Client
+}
+
+// Open returns the CSV of a day.  A day missing from the archive returns an error satisfying
+// errors.Is(err, os.ErrNotExist).
+func (a *Archive) Open(day time.Time) (io.ReadCloser, error) {
+
+	name := day.Format("20060102")
+	if !strings.HasPrefix(a.Source, "http://") && !strings.HasPrefix(a.Source, "https://") {
+		zipPath := filepath.Join(a.Source, name+".zip")
+		if _, err := os.Stat(zipPath); err == nil {
+			return openZippedCSV(zipPath, false)
+		}
+		return os.Open(filepath.Join(a.Source, name+".csv"))
+	}
+
+	url := a.Source
+	if strings.Contains(url, "{date}") {
+		url = strings.ReplaceAll(url, "{date}", name)
+	} else {
+		url = strings.TrimRight(url, "/") + "/" + name + ".zip"
+	}
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", url, os.ErrNotExist)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	// zip needs random access, daily files are tens of MB so spool them to disk
+	tmp, err := ioutil.TempFile("", "rbn-"+name+"-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return openZippedCSV(tmp.Name(), true)
+}
+
+// zippedCSV closes the zip along with the CSV inside it and removes the zip if it was downloaded.
+type zippedCSV struct {
+	io.ReadCloser
+	zip    *zip.ReadCloser
+	path   string
+	remove bool
+}
+
+func (z *zippedCSV) Close() error {
+
+	z.ReadCloser.Close()
+	err := z.zip.Close()
+	if z.remove {
+		os.Remove(z.path)
+	}
+	return err
+}
+
+func openZippedCSV(path string, remove bool) (io.ReadCloser, error) {
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		if remove {
+			os.Remove(path)
+		}
+		return nil, fmt.Errorf("cannot open archive %s: %v", path, err)
+	}
+	for _, f := range zr.File {
+		if strings.EqualFold(filepath.Ext(f.Name), ".csv") {
+			rc, err := f.Open()
+			if err != nil {
+				break
+			}
+			return &zippedCSV{ReadCloser: rc, zip: zr, path: path, remove: remove}, nil
+		}
+	}
+	zr.Close()
+	if remove {
+		os.Remove(path)
+	}
+	return nil, fmt.Errorf("no csv in archive %s", path)
+}
+
+// ReadArchive parses an RBN archive CSV (callsign,de_pfx,de_cont,freq,band,dx,dx_pfx,dx_cont,mode,
+// db,date,speed,tx_mode) into spot records in the same form as ParseSpot, calling fn with each
+// record and its row number starting at 1.  Rows that can't be parsed are logged and skipped.
+func ReadArchive(r io.Reader, fn func(record map[string]interface{}, row int) error) error {
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("cannot read archive header: %v", err)
+	}
+	col := make(map[string]int)
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, name := range []string{"callsign", "freq", "dx", "mode", "db", "date"} {
+		if _, ok := col[name]; !ok {
+			return fmt.Errorf("archive is missing column %s", name)
+		}
+	}
+	field := func(row []string, name string) string {
+		if i, ok := col[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	for n := 1; ; n++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		record, err := archiveRecord(row, field)
+		if err != nil {
+			log.Printf("Archive row %d: %v", n, err)
+			continue
+		}
+		if err := fn(record, n); err != nil {
+			return err
+		}
+	}
+}
+
+func archiveRecord(row []string, field func([]string, string) string) (map[string]interface{}, error) {
+
+	record := make(map[string]interface{})
+	record["callsign"] = skimmerCall(field(row, "callsign"))
+	freq, err := strconv.ParseFloat(field(row, "freq"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("FREQ ERR %v", field(row, "freq"))
+	}
+	record["freq"] = freq
+	record["dx"] = field(row, "dx")
+	record["mode"] = field(row, "mode")
+	db, err := strconv.Atoi(field(row, "db"))
+	if err != nil {
+		return nil, fmt.Errorf("STRENGTH ERR %v", field(row, "db"))
+	}
+	record["db"] = db
+	// Older archives don't have speed or tx_mode for every row
+	speed, _ := strconv.Atoi(field(row, "speed"))
+	record["speed"] = speed
+	record["tx_mode"] = field(row, "tx_mode")
+	date, err := time.Parse("2006-01-02 15:04:05", field(row, "date"))
+	if err != nil {
+		return nil, fmt.Errorf("TIME ERR %v", field(row, "date"))
+	}
+	record["date"] = date.UnixNano() / int64(time.Millisecond)
+	return record, nil
+}
+
+// Progress - Days imported by a backfill, saved after every day and every progressInterval rows so
+// an interrupted import resumes where it stopped.  Progress is only saved once the sinks have
+// flushed what was imported, rows after the last save are imported again (at least once).  An
+// empty Path disables saving.
+type Progress struct {
+	Path      string          `json:"-"`
+	Completed map[string]bool `json:"completed"` // days fully imported, YYYYMMDD
+	Rows      map[string]int  `json:"rows"`      // rows imported of days not completed yet
+}
+
+// LoadProgress reads the progress file, a missing file starts from scratch.
+func LoadProgress(path string) (*Progress, error) {
+
+	p := &Progress{Path: path, Completed: make(map[string]bool), Rows: make(map[string]int)}
+	if path == "" {
+		return p, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("cannot parse progress file %s: %v", path, err)
+	}
+	if p.Completed == nil {
+		p.Completed = make(map[string]bool)
+	}
+	if p.Rows == nil {
+		p.Rows = make(map[string]int)
+	}
+	return p, nil
+}
+
+// Save writes the progress file, replacing it atomically.
+func (p *Progress) Save() error {
+
+	if p.Path == "" {
+		return nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(p.Path), ".progress-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.Path)
+}
+
+// Backfill imports the archive days from and to (inclusive) through the same pipeline as the
+// live feed, skipping what progress records as already imported.  dx_heard windows still open at
+// the last save are rebuilt from the rows after it only.
+func (m *Main) Backfill(archive *Archive, from, to time.Time, progress *Progress) error {
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		name := day.Format("20060102")
+		if progress.Completed[name] {
+			continue
+		}
+		skip := progress.Rows[name]
+		r, err := archive.Open(day)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("No archive for %s.", name)
+		} else if err != nil {
+			return err
+		} else {
+			log.Printf("Importing %s from row %d.", name, skip+1)
+			err = ReadArchive(r, func(record map[string]interface{}, row int) error {
+				if row <= skip {
+					return nil
+				}
+				spotsReceived.Add(1)
+				// Archive times are to the second so they stand in for the time received
+				at := time.Unix(0, record["date"].(int64)*int64(time.Millisecond)).UTC()
+				if err := m.Process(record, at); err != nil {
+					return err
+				}
+				if row%progressInterval == 0 {
+					return m.saveProgress(progress, name, row)
+				}
+				return nil
+			})
+			r.Close()
+			if err != nil {
+				return fmt.Errorf("import of %s failed: %v", name, err)
+			}
+		}
+		if err := m.saveProgress(progress, name, -1); err != nil {
+			return err
+		}
+	}
+	if m.Aggregator != nil {
+		return m.flush(to.AddDate(0, 0, 1).Add(m.Aggregate.Window))
+	}
+	return nil
+}
+
+// Record rows of day as imported, -1 for the whole day, once the sinks have flushed them.
+func (m *Main) saveProgress(progress *Progress, day string, rows int) error {
+
+	for _, sink := range []Sink{m.Sink, m.RawSink} {
+		if sink == nil {
+			continue
+		}
+		if err := sink.Flush(); err != nil {
+			return err
+		}
+	}
+	if rows < 0 {
+		progress.Completed[day] = true
+		delete(progress.Rows, day)
+	} else {
+		progress.Rows[day] = rows
+	}
+	return progress.Save()
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro"
+)
+
+const testArchive = `callsign,de_pfx,de_cont,freq,band,dx,dx_pfx,dx_cont,mode,db,date,speed,tx_mode
+DK9IP-#,DL,EU,14025.1,20m,K1ABC,K,NA,CW,17,2021-10-13 00:00:01,25,CQ
+W3LPL,K,NA,7074.0,40m,JA1XYZ,JA,AS,FT8,-5,2021-10-13 00:00:15,,CQ
+bad,row
+VE2WU,VE,NA,,20m,K1ABC,K,NA,CW,12,2021-10-13 00:01:00,22,CQ
+`
+
+func zipArchive(t *testing.T, name, content string) []byte {
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(content))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, archive *Archive, day time.Time) []map[string]interface{} {
+
+	r, err := archive.Open(day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var records []map[string]interface{}
+	err = ReadArchive(r, func(record map[string]interface{}, row int) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestReadArchive(t *testing.T) {
+
+	var records []map[string]interface{}
+	var rows []int
+	err := ReadArchive(strings.NewReader(testArchive), func(record map[string]interface{}, row int) error {
+		records = append(records, record)
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 valid rows, got %d", len(records))
+	}
+	r := records[0]
+	if r["callsign"] != "DK9IP" || r["dx"] != "K1ABC" || r["freq"] != 14025.1 || r["db"] != 17 ||
+		r["speed"] != 25 || r["tx_mode"] != "CQ" || r["mode"] != "CW" {
+		t.Errorf("Unexpected record %v", r)
+	}
+	if want := time.Date(2021, 10, 13, 0, 0, 1, 0, time.UTC).UnixNano() / int64(time.Millisecond); r["date"] != want {
+		t.Errorf("Got date %v want %v", r["date"], want)
+	}
+	if records[1]["speed"] != 0 || records[1]["db"] != -5 {
+		t.Errorf("Unexpected record %v", records[1])
+	}
+	// Row numbers count skipped rows so resuming lines up
+	if rows[0] != 1 || rows[1] != 2 {
+		t.Errorf("Got rows %v", rows)
+	}
+	if err := ReadArchive(strings.NewReader("a,b,c\n"), nil); err == nil {
+		t.Errorf("Missing columns should fail")
+	}
+}
+
+func TestArchiveURL(t *testing.T) {
+
+	day := time.Date(2021, 10, 13, 0, 0, 0, 0, time.UTC)
+	body := zipArchive(t, "20211013.csv", testArchive)
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		if r.URL.Query().Get("f") == "20211013" || r.URL.Path == "/raw/20211013.zip" {
+			w.Write(body)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	if n := len(readAll(t, &Archive{Source: ts.URL + "/dl.php?f={date}"}, day)); n != 2 {
+		t.Errorf("Expected 2 records, got %d", n)
+	}
+	if n := len(readAll(t, &Archive{Source: ts.URL + "/raw/"}, day)); n != 2 {
+		t.Errorf("Expected 2 records, got %d", n)
+	}
+	if _, err := (&Archive{Source: ts.URL + "/dl.php?f={date}"}).Open(day.AddDate(0, 0, 1)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Missing day should be ErrNotExist, got %v", err)
+	}
+	if paths[0] != "/dl.php?f=20211013" || paths[1] != "/raw/20211013.zip" {
+		t.Errorf("Unexpected requests %v", paths)
+	}
+}
+
+func TestArchiveDir(t *testing.T) {
+
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "20211013.zip"), zipArchive(t, "20211013.csv", testArchive), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "20211014.csv"), []byte(testArchive), 0644)
+
+	archive := &Archive{Source: dir}
+	day := time.Date(2021, 10, 13, 0, 0, 0, 0, time.UTC)
+	if n := len(readAll(t, archive, day)); n != 2 {
+		t.Errorf("Expected 2 records from zip, got %d", n)
+	}
+	if n := len(readAll(t, archive, day.AddDate(0, 0, 1))); n != 2 {
+		t.Errorf("Expected 2 records from csv, got %d", n)
+	}
+	if _, err := archive.Open(day.AddDate(0, 0, 2)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Missing day should be ErrNotExist, got %v", err)
+	}
+}
+
+func TestProgress(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "progress.json")
+	p, err := LoadProgress(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Completed["20211013"] = true
+	p.Rows["20211014"] = 20000
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+	q, err := LoadProgress(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Completed["20211013"] || q.Completed["20211012"] || q.Rows["20211014"] != 20000 {
+		t.Errorf("Progress not restored %+v", q)
+	}
+}
+
+// recordingSink - Sink keeping the dx of what it was given, records only count once flushed.
+type recordingSink struct {
+	failAfter int // fail the publish after this many records, 0 never fails
+	published int
+	pending   []string
+	flushed   []string
+}
+
+func (s *recordingSink) Publish(schema avro.Schema, record map[string]interface{}, at time.Time) error {
+
+	if s.failAfter > 0 && s.published == s.failAfter {
+		return errors.New("sink failed")
+	}
+	s.published++
+	s.pending = append(s.pending, record["dx"].(string))
+	return nil
+}
+
+func (s *recordingSink) Flush() error {
+
+	s.flushed = append(s.flushed, s.pending...)
+	s.pending = nil
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return s.Flush()
+}
+
+// knownStore - Callsign store that has every call, so nothing is looked up on QRZ.
+type knownStore struct{}
+
+func (knownStore) Get(call string) (map[string]interface{}, error) {
+	return map[string]interface{}{"call": call}, nil
+}
+
+func (knownStore) Insert(*QRZDatabase) error { return nil }
+
+func (knownStore) Close() error { return nil }
+
+func TestBackfillResumes(t *testing.T) {
+
+	defer func(n int) { progressInterval = n }(progressInterval)
+	progressInterval = 2
+
+	dir := t.TempDir()
+	header := "callsign,de_pfx,de_cont,freq,band,dx,dx_pfx,dx_cont,mode,db,date,speed,tx_mode\n"
+	row := "DK9IP-#,DL,EU,14025.1,20m,%s,K,NA,CW,17,%s 00:00:01,25,CQ\n"
+	days := map[string][]string{
+		"2021-10-13": {"K1AA", "K1AB", "K1AC"},
+		"2021-10-14": {"W1AA", "W1AB", "W1AC", "W1AD", "W1AE"},
+		"2021-10-15": {"N1AA"},
+	}
+	for day, calls := range days {
+		csv := header
+		for _, call := range calls {
+			csv += fmt.Sprintf(row, call, day)
+		}
+		name := strings.ReplaceAll(day, "-", "") + ".csv"
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(csv), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive := &Archive{Source: dir}
+	path := filepath.Join(t.TempDir(), "progress.json")
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	backfill := func(sink *recordingSink, from, to string) error {
+		m := NewMain(DefaultConfig())
+		m.Deps.Store = knownStore{}
+		if err := m.Init(); err != nil {
+			t.Fatal(err)
+		}
+		m.Sink = sink
+		progress, err := LoadProgress(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.Backfill(archive, day(from), day(to), progress)
+	}
+
+	// Start with the later day
+	sink := &recordingSink{}
+	if err := backfill(sink, "2021-10-15", "2021-10-15"); err != nil {
+		t.Fatal(err)
+	}
+	// An earlier range is still imported, the sink fails on W1AD, what wasn't flushed is lost
+	sink = &recordingSink{failAfter: 6}
+	if err := backfill(sink, "2021-10-13", "2021-10-15"); err == nil {
+		t.Fatal("Expected the sink failure")
+	}
+	if want := []string{"K1AA", "K1AB", "K1AC", "W1AA", "W1AB"}; !reflect.DeepEqual(sink.flushed, want) {
+		t.Errorf("Expected %v flushed, got %v", want, sink.flushed)
+	}
+	if want := []string{"W1AC"}; !reflect.DeepEqual(sink.pending, want) {
+		t.Errorf("Expected %v pending, got %v", want, sink.pending)
+	}
+	// Resumes after the last saved row of the interrupted day
+	sink = &recordingSink{}
+	if err := backfill(sink, "2021-10-13", "2021-10-15"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"W1AC", "W1AD", "W1AE"}; !reflect.DeepEqual(sink.flushed, want) {
+		t.Errorf("Expected %v on resume, got %v", want, sink.flushed)
+	}
+	progress, _ := LoadProgress(path)
+	if len(progress.Completed) != 3 || len(progress.Rows) != 0 {
+		t.Errorf("Expected every day completed, got %+v", progress)
+	}
+}
+
+func TestBackfillSkipQRZ(t *testing.T) {
+
+	dir := t.TempDir()
+	csv := "callsign,de_pfx,de_cont,freq,band,dx,dx_pfx,dx_cont,mode,db,date,speed,tx_mode\n" +
+		"DK9IP-#,DL,EU,14025.1,20m,N1XX,K,NA,CW,17,2021-10-13 00:00:01,25,CQ\n" +
+		"DK9IP-#,DL,EU,7025.3,40m,K1ABC,K,NA,CW,9,2021-10-13 00:00:02,22,CQ\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "20211013.csv"), []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	qrz := &fakeQRZ{states: map[string]string{"K1ABC": "MA"}}
+	qs := httptest.NewServer(qrz)
+	defer qs.Close()
+	store, err := OpenCallsignStore(DBConfig{Driver: DriverSQLite, File: filepath.Join(t.TempDir(), "callsign.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Insert(&QRZDatabase{Call: "N1XX", State: "VT"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.Callbook.QRZ.URL = qs.URL
+	m := NewMain(config)
+	m.Deps.Store = store
+	m.SkipQRZ = true
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	sink := &recordingSink{}
+	m.Sink = sink
+	day := time.Date(2021, 10, 13, 0, 0, 0, 0, time.UTC)
+	if err := m.Backfill(&Archive{Source: dir}, day, day, &Progress{Completed: map[string]bool{},
+		Rows: map[string]int{}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"N1XX", "K1ABC"}; !reflect.DeepEqual(sink.flushed, want) {
+		t.Errorf("Expected %v, got %v", want, sink.flushed)
+	}
+	if qrz.logins != 0 || len(qrz.lookups) != 0 {
+		t.Errorf("Expected no QRZ requests, got %d logins and lookups %v", qrz.logins, qrz.lookups)
+	}
+}
@@ -0,0 +1,166 @@
+// Package bandplan names the amateur band of a frequency using a table driven plan that is aware
+// of the differences between the three IARU regions.
+package bandplan
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Default band plan compiled into the binary.
+//
+//go:embed default.yaml
+var defaultPlan []byte
+
+// Plan is a list of bands plus the entities whose IARU region can't be derived from the continent.
+type Plan struct {
+	Bands         []Band         `yaml:"bands" json:"bands"`
+	EntityRegions map[string]int `yaml:"entity_regions" json:"entity_regions"`
+}
+
+// Band has nominal edges that name it and optional per region allocations.  A region without an
+// entry is allocated the nominal edges.
+type Band struct {
+	Name    string              `yaml:"name" json:"name"`
+	Lower   float64             `yaml:"lower_khz" json:"lower_khz"`
+	Upper   float64             `yaml:"upper_khz" json:"upper_khz"`
+	Regions map[int]*Allocation `yaml:"regions" json:"regions"`
+}
+
+// Allocation lists the ranges and channels (i.e. 60m in the US) allocated in a region.  An empty
+// allocation means the band isn't available in that region.
+type Allocation struct {
+	Ranges       []Range   `yaml:"ranges" json:"ranges"`
+	Channels     []float64 `yaml:"channels_khz" json:"channels_khz"`
+	ChannelWidth float64   `yaml:"channel_width_khz" json:"channel_width_khz"`
+}
+
+// Range is an inclusive frequency range in kHz.
+type Range struct {
+	Lower float64 `yaml:"lower_khz" json:"lower_khz"`
+	Upper float64 `yaml:"upper_khz" json:"upper_khz"`
+}
+
+// Default returns the built-in plan.
+func Default() *Plan {
+
+	p, err := Parse(defaultPlan, false)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Load reads a plan from a YAML or JSON (.json) file.
+func Load(path string) (*Plan, error) {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(b, strings.EqualFold(filepath.Ext(path), ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot load band plan %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// Parse decodes and validates a plan.
+func Parse(b []byte, isJSON bool) (*Plan, error) {
+
+	p := &Plan{}
+	var err error
+	if isJSON {
+		err = json.Unmarshal(b, p)
+	} else {
+		err = yaml.UnmarshalStrict(b, p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Bands) == 0 {
+		return nil, fmt.Errorf("no bands defined")
+	}
+	for _, b := range p.Bands {
+		if b.Name == "" || b.Lower > b.Upper {
+			return nil, fmt.Errorf("bad band definition %+v", b)
+		}
+		for region, a := range b.Regions {
+			if region < 1 || region > 3 {
+				return nil, fmt.Errorf("band %s: IARU region %d out of range", b.Name, region)
+			}
+			if a == nil {
+				b.Regions[region] = &Allocation{}
+			}
+		}
+	}
+	return p, nil
+}
+
+// Lookup returns the band containing freq (kHz) and whether freq is inside the allocation for the
+// region.  Region 0 checks only the nominal edges.  A frequency outside every band returns "".
+func (p *Plan) Lookup(freq float64, region int) (band string, inBand bool) {
+
+	for _, b := range p.Bands {
+		if freq < b.Lower || freq > b.Upper {
+			continue
+		}
+		a, found := b.Regions[region]
+		if !found {
+			return b.Name, true
+		}
+		return b.Name, a.contains(freq)
+	}
+	return "", false
+}
+
+func (a *Allocation) contains(freq float64) bool {
+
+	for _, r := range a.Ranges {
+		if freq >= r.Lower && freq <= r.Upper {
+			return true
+		}
+	}
+	for _, c := range a.Channels {
+		if freq >= c-a.ChannelWidth/2 && freq <= c+a.ChannelWidth/2 {
+			return true
+		}
+	}
+	return false
+}
+
+// Asian ITU zones that are part of IARU Region 1 (Asiatic Russia, the Caucasus, Central Asia,
+// Mongolia and the Middle East west of the Persian Gulf).
+var asiaRegion1Zones = map[int]bool{
+	20: true, 21: true, 22: true, 23: true, 24: true, 25: true, 26: true, 29: true, 30: true, 31: true,
+	32: true, 33: true, 34: true, 35: true, 39: true, 75: true,
+}
+
+// Region returns the IARU region of an entity given its primary prefix, continent and ITU zone, 0
+// if it can't be determined (i.e. Antarctica).
+func (p *Plan) Region(primaryPrefix, continent string, ituz int) int {
+
+	if r, ok := p.EntityRegions[primaryPrefix]; ok {
+		return r
+	}
+	switch continent {
+	case "EU", "AF":
+		return 1
+	case "NA", "SA":
+		return 2
+	case "AS":
+		if asiaRegion1Zones[ituz] {
+			return 1
+		}
+		return 3
+	case "OC":
+		return 3
+	}
+	return 0
+}
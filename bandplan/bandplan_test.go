@@ -0,0 +1,183 @@
+package bandplan
+
+import (
+	"testing"
+)
+
+type edgeCase struct {
+	freq   float64
+	region int
+	band   string
+	inBand bool
+}
+
+// Every nominal band edge, just inside and just outside.
+var nominalEdges = []struct {
+	band         string
+	lower, upper float64
+}{
+	{"2200m", 135.7, 137.8},
+	{"600m", 472, 479},
+	{"160m", 1800, 2000},
+	{"80m", 3500, 4000},
+	{"60m", 5250, 5450},
+	{"40m", 7000, 7300},
+	{"30m", 10100, 10150},
+	{"20m", 14000, 14350},
+	{"17m", 18068, 18168},
+	{"15m", 21000, 21450},
+	{"12m", 24890, 24990},
+	{"10m", 28000, 29700},
+	{"8m", 40660, 40690},
+	{"6m", 50000, 54000},
+	{"5m", 56000, 60100},
+	{"4m", 69900, 70500},
+	{"2m", 144000, 148000},
+	{"1.25m", 219000, 225000},
+	{"70cm", 420000, 450000},
+	{"33cm", 902000, 928000},
+	{"23cm", 1240000, 1300000},
+	{"13cm", 2300000, 2450000},
+}
+
+// Regional allocations that differ from the nominal edges.
+var regionalEdges = []edgeCase{
+	{1809.9, 1, "160m", false},
+	{1810, 1, "160m", true},
+	{1800, 2, "160m", true},
+	{1800, 3, "160m", true},
+	{3800, 1, "80m", true},
+	{3800.1, 1, "80m", false},
+	{3900, 3, "80m", true},
+	{3900.1, 3, "80m", false},
+	{4000, 2, "80m", true},
+	{5351.4, 1, "60m", false},
+	{5351.5, 1, "60m", true},
+	{5366.5, 1, "60m", true},
+	{5366.6, 1, "60m", false},
+	{5332, 2, "60m", true},
+	{5330.6, 2, "60m", true},
+	{5330.5, 2, "60m", false},
+	{5405, 2, "60m", true},
+	{5406.5, 2, "60m", false},
+	{5358.5, 2, "60m", true},
+	{5366.5, 3, "60m", true},
+	{5373, 3, "60m", false},
+	{7200, 1, "40m", true},
+	{7200.1, 1, "40m", false},
+	{7200.1, 3, "40m", false},
+	{7300, 2, "40m", true},
+	{40675, 1, "8m", true},
+	{40675, 2, "8m", false},
+	{52000, 1, "6m", true},
+	{52000.1, 1, "6m", false},
+	{54000, 2, "6m", true},
+	{54000, 3, "6m", true},
+	{60000, 1, "5m", true},
+	{60000, 2, "5m", false},
+	{69900, 1, "4m", true},
+	{70500, 1, "4m", true},
+	{70200, 2, "4m", false},
+	{70200, 3, "4m", false},
+	{146000, 1, "2m", true},
+	{146000.1, 1, "2m", false},
+	{148000, 2, "2m", true},
+	{148000, 3, "2m", true},
+	{222000, 1, "1.25m", false},
+	{222000, 2, "1.25m", true},
+	{222000, 3, "1.25m", false},
+	{429999, 1, "70cm", false},
+	{430000, 1, "70cm", true},
+	{440000, 1, "70cm", true},
+	{440001, 1, "70cm", false},
+	{420000, 2, "70cm", true},
+	{450000, 2, "70cm", true},
+	{440001, 3, "70cm", false},
+	{915000, 1, "33cm", false},
+	{915000, 2, "33cm", true},
+	{915000, 3, "33cm", false},
+}
+
+func TestNominalEdges(t *testing.T) {
+
+	p := Default()
+	for _, e := range nominalEdges {
+		for region := 0; region <= 3; region++ {
+			if band, _ := p.Lookup(e.lower, region); band != e.band {
+				t.Errorf("%.1f region %d: got band '%s' want '%s'", e.lower, region, band, e.band)
+			}
+			if band, _ := p.Lookup(e.upper, region); band != e.band {
+				t.Errorf("%.1f region %d: got band '%s' want '%s'", e.upper, region, band, e.band)
+			}
+			if band, in := p.Lookup(e.lower-0.1, region); band != "" || in {
+				t.Errorf("%.1f region %d: got band '%s' want none", e.lower-0.1, region, band)
+			}
+			if band, in := p.Lookup(e.upper+0.1, region); band != "" || in {
+				t.Errorf("%.1f region %d: got band '%s' want none", e.upper+0.1, region, band)
+			}
+		}
+		if _, in := p.Lookup(e.lower, 0); !in {
+			t.Errorf("%.1f region 0: should be in band", e.lower)
+		}
+		if _, in := p.Lookup(e.upper, 0); !in {
+			t.Errorf("%.1f region 0: should be in band", e.upper)
+		}
+	}
+	if len(nominalEdges) != len(p.Bands) {
+		t.Errorf("Default plan has %d bands, test covers %d", len(p.Bands), len(nominalEdges))
+	}
+}
+
+func TestRegionalEdges(t *testing.T) {
+
+	p := Default()
+	for _, e := range regionalEdges {
+		band, in := p.Lookup(e.freq, e.region)
+		if band != e.band || in != e.inBand {
+			t.Errorf("%.1f region %d: got (%s, %v) want (%s, %v)", e.freq, e.region, band, in, e.band, e.inBand)
+		}
+	}
+}
+
+func TestRegion(t *testing.T) {
+
+	p := Default()
+	cases := []struct {
+		prefix, cont string
+		ituz, region int
+	}{
+		{"DL", "EU", 28, 1},
+		{"ZS", "AF", 57, 1},
+		{"K", "NA", 8, 2},
+		{"PY", "SA", 15, 2},
+		{"JA", "AS", 45, 3},
+		{"UA9", "AS", 30, 1},
+		{"4X", "AS", 39, 1},
+		{"VK", "OC", 55, 3},
+		{"KH6", "OC", 61, 2},
+		{"CE9", "AN", 74, 0},
+	}
+	for _, c := range cases {
+		if r := p.Region(c.prefix, c.cont, c.ituz); r != c.region {
+			t.Errorf("%s: got region %d want %d", c.prefix, r, c.region)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+
+	p, err := Parse([]byte(`{"bands": [{"name": "20m", "lower_khz": 14000, "upper_khz": 14350,
+		"regions": {"2": {"ranges": [{"lower_khz": 14000, "upper_khz": 14150}]}}}]}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if band, in := p.Lookup(14200, 2); band != "20m" || in {
+		t.Errorf("got (%s, %v) want (20m, false)", band, in)
+	}
+	if _, err := Parse([]byte("bands: []"), false); err == nil {
+		t.Errorf("Empty plan should fail")
+	}
+	if _, err := Parse([]byte("bands: [{name: 20m, lower_khz: 14000, upper_khz: 14350, regions: {4: {}}}]"), false); err == nil {
+		t.Errorf("Bad region should fail")
+	}
+}
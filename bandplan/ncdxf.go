@@ -0,0 +1,91 @@
+package bandplan
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// NCDXF/IARU beacons in transmit order.  Each beacon sends for 10 seconds on 14100 kHz then steps
+// up to the next band, so every 3 minutes each beacon has been heard once on every band.
+var ncdxfBeacons = []string{
+	"4U1UN", "VE8AT", "W6WX", "KH6RS", "ZL6B", "VK6RBP", "JA2IGY", "RR9O", "VR2B",
+	"4S7B", "ZS6DN", "5Z4B", "4X6TU", "OH2B", "CS3B", "LU4AA", "OA4B", "YV5B",
+}
+
+var ncdxfFreqs = []float64{14100, 18110, 21150, 24930, 28200}
+
+const (
+	ncdxfSlot = 10 * time.Second
+	// Skimmers report after decoding the transmission and clocks aren't perfect
+	ncdxfSlotTolerance = 2
+	ncdxfFreqTolerance = 0.5
+)
+
+// IsNCDXFBeacon returns true if a spot of call on freq (kHz) at time at matches the beacon schedule,
+// i.e. the call is an NCDXF beacon, freq is a beacon frequency and the beacon's time slot on that
+// band is within a couple of slots of at.
+func IsNCDXFBeacon(call string, freq float64, at time.Time) bool {
+
+	beacon := -1
+	for i, b := range ncdxfBeacons {
+		if strings.EqualFold(b, call) {
+			beacon = i
+			break
+		}
+	}
+	if beacon < 0 {
+		return false
+	}
+	for band, f := range ncdxfFreqs {
+		if math.Abs(freq-f) > ncdxfFreqTolerance {
+			continue
+		}
+		return ncdxfSlotDistance(NCDXFSlot(at), beacon+band) <= ncdxfSlotTolerance
+	}
+	return false
+}
+
+// NCDXFSlot returns the 10 second slot (0-17) of the 3 minute beacon cycle at time t.  The beacon
+// transmitting on 14100 kHz in slot n is ncdxfBeacons[n], on the next band up ncdxfBeacons[n-1] and
+// so on.
+func NCDXFSlot(t time.Time) int {
+
+	cycle := time.Duration(len(ncdxfBeacons)) * ncdxfSlot
+	return int(t.UTC().Sub(t.UTC().Truncate(cycle)) / ncdxfSlot)
+}
+
+// Distance between two slots around the cycle.
+func ncdxfSlotDistance(a, b int) int {
+
+	n := len(ncdxfBeacons)
+	d := ((a-b)%n + n) % n
+	if d > n/2 {
+		d = n - d
+	}
+	return d
+}
+
+// NCDXFBeacon returns the beacon transmitting on freq (kHz) at time t, "" if freq isn't a beacon
+// frequency.
+func NCDXFBeacon(freq float64, t time.Time) string {
+
+	n := len(ncdxfBeacons)
+	for band, f := range ncdxfFreqs {
+		if math.Abs(freq-f) <= ncdxfFreqTolerance {
+			return ncdxfBeacons[((NCDXFSlot(t)-band)%n+n)%n]
+		}
+	}
+	return ""
+}
+
+// NCDXFFreq returns the beacon frequency (kHz) nearest freq, false if freq isn't a beacon frequency.
+func NCDXFFreq(freq float64) (float64, bool) {
+
+	for _, f := range ncdxfFreqs {
+		if math.Abs(freq-f) <= ncdxfFreqTolerance {
+			return f, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,125 @@
+package bandplan
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Default segment map compiled into the binary.
+//
+//go:embed segments.yaml
+var defaultSegments []byte
+
+// SegmentMap classifies a frequency within a band (CW, digital, phone, beacon ...).  Segments are
+// checked in order and the first match wins.
+type SegmentMap struct {
+	Segments []Segment `yaml:"segments" json:"segments"`
+}
+
+// Segment is an inclusive frequency range in kHz, optionally restricted to some modes and IARU
+// regions.
+type Segment struct {
+	Name    string   `yaml:"name" json:"name"`
+	Lower   float64  `yaml:"lower_khz" json:"lower_khz"`
+	Upper   float64  `yaml:"upper_khz" json:"upper_khz"`
+	Modes   []string `yaml:"modes" json:"modes"`
+	Regions []int    `yaml:"regions" json:"regions"`
+}
+
+// DefaultSegments returns the built-in segment map.
+func DefaultSegments() *SegmentMap {
+
+	m, err := ParseSegments(defaultSegments, false)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// LoadSegments reads a segment map from a YAML or JSON (.json) file.
+func LoadSegments(path string) (*SegmentMap, error) {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ParseSegments(b, strings.EqualFold(filepath.Ext(path), ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot load segment map %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// ParseSegments decodes and validates a segment map.
+func ParseSegments(b []byte, isJSON bool) (*SegmentMap, error) {
+
+	m := &SegmentMap{}
+	var err error
+	if isJSON {
+		err = json.Unmarshal(b, m)
+	} else {
+		err = yaml.UnmarshalStrict(b, m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Segments) == 0 {
+		return nil, fmt.Errorf("no segments defined")
+	}
+	for _, s := range m.Segments {
+		if s.Name == "" || s.Lower > s.Upper {
+			return nil, fmt.Errorf("bad segment definition %+v", s)
+		}
+		for _, r := range s.Regions {
+			if r < 1 || r > 3 {
+				return nil, fmt.Errorf("segment %s: IARU region %d out of range", s.Name, r)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Lookup returns the name of the first segment containing freq (kHz) for the mode and IARU region,
+// "" if there isn't one.  Region 0 matches only segments without a region restriction.
+func (m *SegmentMap) Lookup(freq float64, mode string, region int) string {
+
+	for _, s := range m.Segments {
+		if freq < s.Lower || freq > s.Upper {
+			continue
+		}
+		if len(s.Modes) > 0 && !containsMode(s.Modes, mode) {
+			continue
+		}
+		if len(s.Regions) > 0 && !containsRegion(s.Regions, region) {
+			continue
+		}
+		return s.Name
+	}
+	return ""
+}
+
+func containsMode(modes []string, mode string) bool {
+
+	for _, m := range modes {
+		if strings.EqualFold(m, mode) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRegion(regions []int, region int) bool {
+
+	for _, r := range regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
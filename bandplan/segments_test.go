@@ -0,0 +1,92 @@
+package bandplan
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSegments(t *testing.T) {
+
+	m := DefaultSegments()
+	cases := []struct {
+		freq    float64
+		mode    string
+		region  int
+		segment string
+	}{
+		{14025, "CW", 2, "cw"},
+		{14074.5, "FT8", 2, "ft8"},
+		{14074.5, "CW", 2, "digital"},
+		{14080.5, "FT4", 1, "ft4"},
+		{14100, "CW", 1, "beacon"},
+		{14200, "CW", 2, "phone"},
+		{7050, "CW", 1, "digital"},
+		{7050, "CW", 2, "digital"},
+		{7100, "CW", 1, "phone"},
+		{7100, "CW", 2, "digital"},
+		{28210, "CW", 2, "beacon"},
+		{50050, "CW", 2, "beacon"},
+		{50050, "CW", 1, "cw"},
+		{50450, "CW", 1, "beacon"},
+		{5357.5, "FT8", 2, "ft8"},
+		{5357.5, "RTTY", 2, "digital"},
+		{5357.5, "CW", 2, "cw"},
+		{3700, "CW", 0, "phone"},
+		{14400, "CW", 2, ""},
+	}
+	for _, c := range cases {
+		if s := m.Lookup(c.freq, c.mode, c.region); s != c.segment {
+			t.Errorf("%.1f %s region %d: got segment '%s' want '%s'", c.freq, c.mode, c.region, s, c.segment)
+		}
+	}
+	if _, err := ParseSegments([]byte("segments: [{name: cw, lower_khz: 1, upper_khz: 2, regions: [5]}]"), false); err == nil {
+		t.Errorf("Bad region should fail")
+	}
+}
+
+func TestNCDXFSchedule(t *testing.T) {
+
+	start := time.Date(2021, 10, 13, 12, 3, 0, 0, time.UTC)
+	if s := NCDXFSlot(start); s != 0 {
+		t.Errorf("Cycle start: got slot %d want 0", s)
+	}
+	cases := []struct {
+		offset time.Duration
+		freq   float64
+		beacon string
+	}{
+		{0, 14100, "4U1UN"},
+		{0, 18110, "YV5B"},
+		{10 * time.Second, 18110, "4U1UN"},
+		{40 * time.Second, 28200, "4U1UN"},
+		{20 * time.Second, 14100, "W6WX"},
+		{175 * time.Second, 14100, "YV5B"},
+		{0, 7025, ""},
+	}
+	for _, c := range cases {
+		if b := NCDXFBeacon(c.freq, start.Add(c.offset)); b != c.beacon {
+			t.Errorf("%v %.0f: got '%s' want '%s'", c.offset, c.freq, b, c.beacon)
+		}
+	}
+}
+
+func TestIsNCDXFBeacon(t *testing.T) {
+
+	// W6WX is on 21150 in slot 4 (40 seconds into the cycle)
+	slot := time.Date(2021, 10, 13, 12, 3, 40, 0, time.UTC)
+	if !IsNCDXFBeacon("W6WX", 21150.1, slot) {
+		t.Errorf("W6WX should be on 21150 at %v", slot)
+	}
+	if !IsNCDXFBeacon("w6wx", 21150, slot.Add(15*time.Second)) {
+		t.Errorf("Reporting delay should be tolerated")
+	}
+	if IsNCDXFBeacon("W6WX", 21150, slot.Add(90*time.Second)) {
+		t.Errorf("W6WX isn't on 21150 half a cycle later")
+	}
+	if IsNCDXFBeacon("W6WX", 21060, slot) {
+		t.Errorf("21060 isn't a beacon frequency")
+	}
+	if IsNCDXFBeacon("W6ABC", 21150, slot) {
+		t.Errorf("W6ABC isn't a beacon")
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.disney.com/guys-workspace/rbn-to-kinesis/bandplan"
+	"gopkg.in/yaml.v2"
+)
+
+// Tuning of the calibration estimates.
+const (
+	calibrationAlpha      = 0.05 // weight of a new sample in the moving average
+	calibrationMinSamples = 10   // samples before a learned estimate is applied
+	calibrationMinPeers   = 2    // other skimmers needed to form a reference frequency
+	calibrationMaxPPM     = 25.0 // larger disagreements are a different signal, not an offset
+)
+
+// Calibrator estimates the frequency offset of each skimmer in parts per million, comparing its
+// reports against NCDXF beacons, whose frequency is known exactly, and against the median of the
+// other skimmers reporting the same DX within Window and FreqTolerance kHz.
+type Calibrator struct {
+	Window        time.Duration
+	FreqTolerance float64
+	mu            sync.Mutex
+	estimates     map[string]*Estimate
+	recent        []calibrationSpot
+}
+
+// Estimate - Offset of a skimmer, a positive PPM reports frequencies too high.  Seeded estimates
+// come from the override file and are applied regardless of the number of samples.
+type Estimate struct {
+	PPM     float64   `json:"ppm" yaml:"ppm"`
+	Samples int       `json:"samples" yaml:"samples"`
+	Seeded  bool      `json:"seeded" yaml:"seeded"`
+	Updated time.Time `json:"updated" yaml:"updated"`
+}
+
+type calibrationSpot struct {
+	skimmer string
+	dx      string
+	freq    float64
+	at      time.Time
+}
+
+// NewCalibrator creates a calibrator without estimates.
+func NewCalibrator(window time.Duration, freqTolerance float64) *Calibrator {
+	return &Calibrator{Window: window, FreqTolerance: freqTolerance, estimates: make(map[string]*Estimate)}
+}
+
+// Observe records a spot and updates the estimate of the skimmer if a reference frequency is
+// available.  beacon indicates the spot matched the NCDXF schedule.
+func (c *Calibrator) Observe(skimmer, dx string, freq float64, at time.Time, beacon bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune(at)
+
+	reference := 0.0
+	if f, ok := bandplan.NCDXFFreq(freq); ok && beacon {
+		reference = f
+	} else {
+		var peers []float64
+		for _, r := range c.recent {
+			if r.dx == dx && r.skimmer != skimmer && math.Abs(r.freq-freq) <= c.FreqTolerance {
+				peers = append(peers, c.correct(r.skimmer, r.freq))
+			}
+		}
+		if len(peers) >= calibrationMinPeers {
+			reference = median(peers)
+		}
+	}
+	c.recent = append(c.recent, calibrationSpot{skimmer: skimmer, dx: dx, freq: freq, at: at})
+	if reference == 0 {
+		return
+	}
+	sample := (freq - reference) / reference * 1e6
+	if math.Abs(sample) > calibrationMaxPPM {
+		return
+	}
+	e := c.estimates[skimmer]
+	if e == nil {
+		e = &Estimate{PPM: sample}
+		c.estimates[skimmer] = e
+	}
+	e.PPM += calibrationAlpha * (sample - e.PPM)
+	e.Samples++
+	e.Updated = at
+}
+
+// Correct returns freq (kHz) with the estimated offset of the skimmer removed.
+func (c *Calibrator) Correct(skimmer string, freq float64) float64 {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.correct(skimmer, freq)
+}
+
+func (c *Calibrator) correct(skimmer string, freq float64) float64 {
+
+	e := c.estimates[skimmer]
+	if e == nil || (!e.Seeded && e.Samples < calibrationMinSamples) {
+		return freq
+	}
+	return freq / (1 + e.PPM/1e6)
+}
+
+// Drop spots that have aged out of the window.
+func (c *Calibrator) prune(now time.Time) {
+
+	i := 0
+	for i < len(c.recent) && now.Sub(c.recent[i].at) > c.Window {
+		i++
+	}
+	c.recent = c.recent[i:]
+}
+
+// Estimates returns a copy of the current estimates keyed by skimmer.
+func (c *Calibrator) Estimates() map[string]Estimate {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := make(map[string]Estimate, len(c.estimates))
+	for k, e := range c.estimates {
+		m[k] = *e
+	}
+	return m
+}
+
+// LoadOverrides seeds estimates from a YAML file mapping skimmer calls to offsets in PPM.
+// Learning continues from the seeded value.  Only skimmers without an estimate are seeded, so
+// estimates restored by Load win, remove a skimmer from the state file to seed it again.
+func (c *Calibrator) LoadOverrides(path string) error {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	overrides := make(map[string]float64)
+	if err := yaml.UnmarshalStrict(b, &overrides); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for skimmer, ppm := range overrides {
+		if _, ok := c.estimates[skimmer]; !ok {
+			c.estimates[skimmer] = &Estimate{PPM: ppm, Seeded: true}
+		}
+	}
+	return nil
+}
+
+// Load restores estimates persisted by Save, a missing file is not an error.
+func (c *Calibrator) Load(path string) error {
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	estimates := make(map[string]*Estimate)
+	if err := json.Unmarshal(b, &estimates); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range estimates {
+		c.estimates[k] = e
+	}
+	return nil
+}
+
+// Save writes the estimates to path as JSON, replacing the file atomically.
+func (c *Calibrator) Save(path string) error {
+
+	b, err := json.MarshalIndent(c.Estimates(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".calibration-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Run saves the estimates to path every interval, and once more when stop is closed.  An
+// interval of 0 only saves on stop.
+func (c *Calibrator) Run(path string, interval time.Duration, stop <-chan struct{}) {
+
+	if path == "" {
+		return
+	}
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-stop:
+			if err := c.Save(path); err != nil {
+				log.Printf("Calibration save failed: %v", err)
+			}
+			return
+		case <-tick:
+			if err := c.Save(path); err != nil {
+				log.Printf("Calibration save failed: %v", err)
+			}
+		}
+	}
+}
+
+func median(v []float64) float64 {
+
+	sort.Float64s(v)
+	n := len(v)
+	if n%2 == 1 {
+		return v[n/2]
+	}
+	return (v[n/2-1] + v[n/2]) / 2
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func ppmOff(freq, ppm float64) float64 {
+	return freq * (1 + ppm/1e6)
+}
+
+func TestCalibratorBeacon(t *testing.T) {
+
+	t0 := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := NewCalibrator(time.Minute, 0.3)
+
+	// Off by more than the cap, a different signal rather than an offset
+	c.Observe("DK9IP", "4U1UN", ppmOff(14100, 28), t0, true)
+	if _, ok := c.Estimates()["DK9IP"]; ok {
+		t.Error("Expected a sample over the cap to be ignored")
+	}
+
+	freq := ppmOff(14100, 10)
+	for i := 0; i < calibrationMinSamples-1; i++ {
+		c.Observe("DK9IP", "4U1UN", freq, t0.Add(time.Duration(i)*time.Second), true)
+	}
+	e := c.Estimates()["DK9IP"]
+	if e.Samples != calibrationMinSamples-1 || math.Abs(e.PPM-10) > 1e-6 {
+		t.Errorf("Unexpected estimate %+v", e)
+	}
+	// Not applied until there are enough samples
+	if got := c.Correct("DK9IP", freq); got != freq {
+		t.Errorf("Expected %v uncorrected below %d samples, got %v", freq, calibrationMinSamples, got)
+	}
+	c.Observe("DK9IP", "4U1UN", freq, t0.Add(10*time.Second), true)
+	if got := c.Correct("DK9IP", freq); math.Abs(got-14100) > 1e-6 {
+		t.Errorf("Expected 14100 corrected, got %v", got)
+	}
+	// Other skimmers are left alone
+	if got := c.Correct("W3LPL", freq); got != freq {
+		t.Errorf("Expected W3LPL uncorrected, got %v", got)
+	}
+}
+
+func TestCalibratorPeers(t *testing.T) {
+
+	t0 := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := NewCalibrator(time.Minute, 0.3)
+
+	// A single peer is no reference
+	c.Observe("W3LPL", "K1ABC", 7025.0, t0, false)
+	c.Observe("DK9IP", "K1ABC", 7025.0, t0, false)
+	if _, ok := c.Estimates()["DK9IP"]; ok {
+		t.Error("Expected no estimate from a single peer")
+	}
+	// The median of the others, the outlier doesn't move it
+	c.Observe("KM3T", "K1ABC", ppmOff(7025.0, 20), t0, false)
+	c.Observe("N4ZR", "K1ABC", ppmOff(7025.0, 8), t0, false)
+	e, ok := c.Estimates()["N4ZR"]
+	if !ok || e.Samples != 1 || math.Abs(e.PPM-8) > 1e-3 {
+		t.Errorf("Expected 8 ppm against the median, got %+v", e)
+	}
+	// Another DX, a frequency outside the tolerance and spots older than the window don't count
+	c.Observe("N1MM", "W6XYZ", ppmOff(7025.0, 8), t0, false)
+	c.Observe("N1MM", "K1ABC", 7026.0, t0, false)
+	c.Observe("N1MM", "K1ABC", ppmOff(7025.0, 8), t0.Add(2*time.Minute), false)
+	if e, ok := c.Estimates()["N1MM"]; ok {
+		t.Errorf("Expected no estimate for N1MM, got %+v", e)
+	}
+}
+
+func TestCalibratorSaveLoad(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "calibration.json")
+	t0 := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := NewCalibrator(time.Minute, 0.3)
+	for i := 0; i < calibrationMinSamples; i++ {
+		c.Observe("DK9IP", "4U1UN", ppmOff(14100, 10), t0, true)
+	}
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewCalibrator(time.Minute, 0.3)
+	if err := restored.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	want, got := c.Estimates()["DK9IP"], restored.Estimates()["DK9IP"]
+	if got.PPM != want.PPM || got.Samples != want.Samples || !got.Updated.Equal(want.Updated) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	if err := NewCalibrator(time.Minute, 0.3).Load(filepath.Join(dir, "missing.json")); err != nil {
+		t.Errorf("Expected a missing file to be ignored, got %v", err)
+	}
+
+	// Overrides only seed skimmers without an estimate, and apply right away
+	overrides := filepath.Join(dir, "overrides.yaml")
+	if err := ioutil.WriteFile(overrides, []byte("DK9IP: -3\nDK8NE: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.LoadOverrides(overrides); err != nil {
+		t.Fatal(err)
+	}
+	if e := restored.Estimates()["DK9IP"]; e.Seeded || e.PPM != want.PPM {
+		t.Errorf("Expected the learned estimate kept, got %+v", e)
+	}
+	if got := restored.Correct("DK8NE", ppmOff(7025, 2)); math.Abs(got-7025) > 1e-6 {
+		t.Errorf("Expected the seeded offset applied, got %v", got)
+	}
+}
+
+func TestCalibratorRunSavesOnStop(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "calibration.json")
+	c := NewCalibrator(time.Minute, 0.3)
+	c.Observe("DK9IP", "4U1UN", ppmOff(14100, 10), time.Now(), true)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.Run(path, time.Hour, stop)
+		close(done)
+	}()
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after stop")
+	}
+	restored := NewCalibrator(time.Minute, 0.3)
+	if err := restored.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restored.Estimates()["DK9IP"]; !ok {
+		t.Error("Expected the estimates saved on stop")
+	}
+}
@@ -0,0 +1,98 @@
+package callparser
+
+import (
+	"strings"
+)
+
+// States in each US call area.
+var usCallAreas = map[string][]string{
+	"1": {"CT", "ME", "MA", "NH", "RI", "VT"},
+	"2": {"NJ", "NY"},
+	"3": {"DE", "DC", "MD", "PA"},
+	"4": {"AL", "FL", "GA", "KY", "NC", "SC", "TN", "VA"},
+	"5": {"AR", "LA", "MS", "NM", "OK", "TX"},
+	"6": {"CA"},
+	"7": {"AZ", "ID", "MT", "NV", "OR", "UT", "WA", "WY"},
+	"8": {"MI", "OH", "WV"},
+	"9": {"IL", "IN", "WI"},
+	"0": {"CO", "IA", "KS", "MN", "MO", "NE", "ND", "SD"},
+}
+
+// Canadian provinces by call area, shared by all the Canadian prefix blocks (VE, VA, CF, XJ ...).
+var caCallAreas = map[string]string{
+	"1": "NS",
+	"2": "QC",
+	"3": "ON",
+	"4": "MB",
+	"5": "SK",
+	"6": "AB",
+	"7": "BC",
+	"8": "NT",
+	"9": "NB",
+}
+
+// Canadian prefixes whose area doesn't follow the digit mapping.
+var caSpecialAreas = map[string]string{
+	"VO1": "NL",
+	"VO2": "NL",
+	"VY0": "NU",
+	"VY1": "YT",
+	"VY2": "PE",
+}
+
+// Region returns the call area of a US or Canadian station (i.e. W6 or VE3), empty otherwise.
+func (st *Station) Region() string {
+
+	switch st.PrimaryPrefix {
+	case "K":
+		if st.CallArea != "" {
+			return "W" + st.CallArea
+		}
+	case "VE":
+		area := canadianArea(prefixSource(st))
+		if _, ok := caSpecialAreas[area]; ok {
+			return area
+		}
+		if len(area) > 0 {
+			return "VE" + area[len(area)-1:]
+		}
+	}
+	return ""
+}
+
+// States returns the states or provinces covered by the station's call area.
+func (st *Station) States() []string {
+
+	region := st.Region()
+	switch {
+	case region == "":
+		return nil
+	case st.PrimaryPrefix == "K":
+		return usCallAreas[region[1:]]
+	case caSpecialAreas[region] != "":
+		return []string{caSpecialAreas[region]}
+	}
+	if p, ok := caCallAreas[region[len(region)-1:]]; ok {
+		return []string{p}
+	}
+	return nil
+}
+
+// State returns the state or province if the call area determines it, empty otherwise.
+func (st *Station) State() string {
+
+	if states := st.States(); len(states) == 1 {
+		return states[0]
+	}
+	return ""
+}
+
+// Leading letters and first digit of a Canadian call or prefix, i.e. VE3 for VE3ABC.
+func canadianArea(call string) string {
+
+	i := strings.IndexAny(call, "0123456789")
+	if i < 0 {
+		return ""
+	}
+	return call[:i+1]
+}
@@ -0,0 +1,27 @@
+package callparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCallArea(t *testing.T) {
+
+	assertEqual(t, NewStation("W6ABC").Region(), "W6")
+	assertEqual(t, NewStation("W6ABC").State(), "CA")
+	assertEqual(t, NewStation("K1ABC").Region(), "W1")
+	assertEqual(t, NewStation("K1ABC").State(), "")
+	assertEqual(t, strings.Join(NewStation("K1ABC").States(), ","), "CT,ME,MA,NH,RI,VT")
+	assertEqual(t, NewStation("W3LPL/6").Region(), "W6")
+	assertEqual(t, NewStation("W3LPL/6").State(), "CA")
+	assertEqual(t, NewStation("KH6ABC").Region(), "")
+	assertEqual(t, NewStation("VE3ABC").Region(), "VE3")
+	assertEqual(t, NewStation("VE3ABC").State(), "ON")
+	assertEqual(t, NewStation("VA7XY").State(), "BC")
+	assertEqual(t, NewStation("VY1AB").Region(), "VY1")
+	assertEqual(t, NewStation("VY1AB").State(), "YT")
+	assertEqual(t, NewStation("VO1AA").State(), "NL")
+	assertEqual(t, NewStation("VE2/K1ABC").State(), "QC")
+	assertEqual(t, NewStation("DH1TW").Region(), "")
+	assertEqual(t, len(NewStation("DH1TW").States()), 0)
+}
@@ -5,7 +5,8 @@ import (
     "strings"
     "strconv"
     "log"
-    "os"
+    "io"
+    "fmt"
     "bufio"
     "regexp"
 )
@@ -27,6 +28,8 @@ type Station struct {
     Am                     bool
     Beacon                 bool
     CallArea               string
+    Dxcc                   int  // ADIF DXCC entity code, 0 if the country file has none
+    db                     *Database
 }
 
 type CountryInfo struct {
@@ -38,18 +41,23 @@ type CountryInfo struct {
     Longitude              float32
     Offset                 float32
     PrimaryPrefix          string
-	CountryNum			   int
+	CountryNum			   int  // ADIF DXCC entity code if the file has one, otherwise the position in the file
+    WAE                    bool // WAE or CQ only entity, not on the DXCC list
 }
 
+// PrefixAlias is a prefix or exact call (=CALL) entry with any per-entry overrides applied
 type PrefixAlias struct {
     Prefix                 string
     Cqz                    int
     Ituz                   int
+    Latitude               float32
+    Longitude              float32
+    Continent              string
+    Offset                 float32
+    Exact                  bool
     Parent                 *CountryInfo
 }
 
-var countries, countriesByNo, prefixes = loadCtyMap("./callparser")
-
 var contintents = map[string]int{
   "NA": 1,
   "SA": 2,
@@ -60,37 +68,48 @@ var contintents = map[string]int{
   "AN": 7,
 }
 
-var reEndPrefix *regexp.Regexp = regexp.MustCompile("[([]")
+var reEndPrefix *regexp.Regexp = regexp.MustCompile("[([<{~]")
 var reGetCQZ *regexp.Regexp = regexp.MustCompile("(?:[(])([0-9]+)(?:[)])")
 var reGetITUZ *regexp.Regexp = regexp.MustCompile("(?:[[])([0-9]+)(?:[]])")
+var reGetLatLon *regexp.Regexp = regexp.MustCompile("<(-?[0-9.]+)/(-?[0-9.]+)>")
+var reGetCont *regexp.Regexp = regexp.MustCompile("{([A-Z]{2})}")
+var reGetOffset *regexp.Regexp = regexp.MustCompile("~(-?[0-9.]+)~")
 var reHas3Char = *regexp.MustCompile("(?i)[/A-Z0-9\\-]{3,15}")  // Make sure the call has at least 3 characters
 var reLeadingNumber = *regexp.MustCompile("(?i)^[0-9]{1}[A-Z]{1,2}?([0-9]{1})[A-Z]+$")
 var reLeadingAlpha = *regexp.MustCompile("(?i)^[A-Z]{1,2}?([0-9]{1,4})[A-Z]+$")
 var reRemoveDashSuffix = *regexp.MustCompile("(?i)[-]{1}[0-9#-]{1,4}$")
+var reVersion = regexp.MustCompile("^=VER[0-9]{8}$")  // AD1C files carry their release date as a pseudo call
 
+// NewStation parses a callsign against the default country database.
 func NewStation(input string) *Station {
+    return Default().NewStation(input)
+}
+
+// NewStation parses a callsign against this country database.
+func (db *Database) NewStation(input string) *Station {
     s := new(Station)
+    s.db = db
     s.Valid = false
     s.Call = strings.ToUpper(strings.TrimSpace(input))
     s.parseCall(s.Call)
+    if exception, ok := db.lookupExact(s.Call); ok && !s.Mm && !s.Am {
+        // Exact call exceptions take priority over the prefix
+        s.Valid = true
+        s.Prefix = exception.Prefix
+        s.setCountry(exception)
+        return s
+    }
     if !s.Valid {
         log.Printf("Busted Homecall: '%s' of %s could not be decoded", s.Homecall, s.Call)
     } else {
         if !s.Mm && !s.Am {
             if s.Prefix == ""  {
                 log.Printf("Busted Prefix: '%s' of %s could not be decoded", s.Prefix, s.Call)
-            } else if ctyInfo, ok := prefixes[s.Prefix]; !ok {
+            } else if ctyInfo, ok := db.prefixes[s.Prefix]; !ok {
                 s.Valid = false
                 log.Printf("Warning Busted: No country info found for '%s'", s.Call)
             } else {
-                s.Country = ctyInfo.Parent.Country
-                s.Latitude = ctyInfo.Parent.Latitude
-                s.Longitude = ctyInfo.Parent.Longitude
-                s.PrimaryPrefix = ctyInfo.Parent.PrimaryPrefix
-                s.Cqz = ctyInfo.Cqz
-                s.Ituz = ctyInfo.Ituz
-                s.Continent = ctyInfo.Parent.Continent
-                s.Offset = ctyInfo.Parent.Offset
+                s.setCountry(ctyInfo)
             }
         }
     }
@@ -98,6 +117,44 @@ func NewStation(input string) *Station {
 }
 
 
+func (st *Station) setCountry(ctyInfo PrefixAlias) {
+    st.Country = ctyInfo.Parent.Country
+    st.Latitude = ctyInfo.Latitude
+    st.Longitude = ctyInfo.Longitude
+    st.PrimaryPrefix = ctyInfo.Parent.PrimaryPrefix
+    st.Cqz = ctyInfo.Cqz
+    st.Ituz = ctyInfo.Ituz
+    st.Continent = ctyInfo.Continent
+    st.Offset = ctyInfo.Offset
+    if st.db.adif {
+        st.Dxcc = ctyInfo.Parent.CountryNum
+    }
+}
+
+
+// Look for the call in the exact call exceptions, then again with any /P, /M or /QRP style
+// designators removed.
+func (db *Database) lookupExact(call string) (PrefixAlias, bool) {
+    call = reRemoveDashSuffix.ReplaceAllString(call, "")
+    for {
+        if a, ok := db.calls[call]; ok {
+            return a, true
+        }
+        i := strings.LastIndex(call, "/")
+        if i < 0 {
+            break
+        }
+        switch call[i+1:] {
+            case "P", "M", "QRP", "QRPP", "LH":
+                call = call[:i]
+            default:
+                return PrefixAlias{}, false
+        }
+    }
+    return PrefixAlias{}, false
+}
+
+
 func (st *Station) parseCall(call string) {
     if a := reHas3Char.FindStringSubmatch(call); a != nil {
         call = reRemoveDashSuffix.ReplaceAllString(call, "")
@@ -117,7 +174,7 @@ func (st *Station) parseCall(call string) {
                 } else { 
                     if okc1, okp1 := st.checkCall(segments[0], segments[1]); okc1 && okp1 {
                         if okc2, okp2 := st.checkCall(segments[1], segments[0]); okc2 && okp2 {
-                            if prefix, ok := iteratePrefix(segments[1]); ok {
+                            if prefix, ok := st.db.iteratePrefix(segments[1]); ok {
                                // Handle situation where homecall is also a prefix (i.e. VP2E)
                                if st.Homecall == prefix {
                                   st.Prefix = segments[1]
@@ -126,7 +183,7 @@ func (st *Station) parseCall(call string) {
                             }
                         } else {
                             st.Homecall = segments[0]
-                            if prefix, ok := iteratePrefix(segments[1]); ok {
+                            if prefix, ok := st.db.iteratePrefix(segments[1]); ok {
                                 st.Prefix = prefix
                             }
                         }
@@ -184,7 +241,7 @@ func (st *Station) checkCall(call string, prefix string) (validCall bool, validP
     } else {
          validCall = false
     }
-    prefix, valid := iteratePrefix(prefix)
+    prefix, valid := st.db.iteratePrefix(prefix)
     validPrefix = valid
     if validCall {
         st.Homecall = call
@@ -229,37 +286,39 @@ func (st *Station) checkDesig(s string) bool {
     return hasDesig
 }
 
+// LookupCountry returns country info by primary prefix from the default country database.
 func LookupCountry(prefix string) (*CountryInfo, bool) {
+    return Default().LookupCountry(prefix)
+}
 
-	if c, ok := countries[prefix]; ok {
+// LookupCountryByNo returns country info by number from the default country database.
+func LookupCountryByNo(id int) (*CountryInfo, bool) {
+    return Default().LookupCountryByNo(id)
+}
+
+func (db *Database) LookupCountry(prefix string) (*CountryInfo, bool) {
+
+	if c, ok := db.countries[prefix]; ok {
 		return &c, ok
 	}
 	return nil, false
 } 
 
-func LookupCountryByNo(id int) (*CountryInfo, bool) {
+func (db *Database) LookupCountryByNo(id int) (*CountryInfo, bool) {
 
-	if c, ok := countriesByNo[id]; ok {
+	if c, ok := db.countriesByNo[id]; ok {
 		return &c, ok
 	}
 	return nil, false
 } 
 
-func loadCtyMap(path string) (countries map[string]CountryInfo, countriesByNo map[int]CountryInfo, aliases map[string]PrefixAlias) {
-
-    file, err := os.Open(path + "/cty.dat")
-    if err != nil {
-        log.Fatal(err)
-        os.Exit(1)
-    }
-    defer file.Close()
-
-    countries = make(map[string]CountryInfo, 0)
-    countriesByNo = make(map[int]CountryInfo, 0)
-    aliases = make(map[string]PrefixAlias, 0)
+// Classic colon separated cty.dat layout, also used by cty_wt_mod.dat and wae_cty.dat.  Entities
+// flagged with a '*' (WAE or CQ only) are kept only if includeWAE is set.  Entities are numbered by
+// their position in the file whether or not they are kept.
+func loadCtyMap(r io.Reader, includeWAE bool) (db *Database, err error) {
 
-    //scan := bufio.NewScanner(result.Body)
-    scan := bufio.NewScanner(file)
+    b := newCtyBuilder()
+    scan := bufio.NewScanner(r)
     
     var fields []string
     var prefixes [] string
@@ -268,6 +327,9 @@ func loadCtyMap(path string) (countries map[string]CountryInfo, countriesByNo ma
 	countryNum := 0
     for scan.Scan() {
         line := scan.Text()
+        if strings.TrimSpace(line) == "" {
+            continue
+        }
         fields = strings.Split(line, ":")
 
         var isFieldLine bool = false
@@ -310,58 +372,42 @@ func loadCtyMap(path string) (countries map[string]CountryInfo, countriesByNo ma
                 c.Offset = float32(offset)
             }
             c.PrimaryPrefix = strings.TrimSpace(fields[7])
+            if strings.HasPrefix(c.PrimaryPrefix, "*") {
+                c.PrimaryPrefix = c.PrimaryPrefix[1:]
+                c.WAE = true
+            }
         } else {
-            for _, v := range prefixes {
-                a := new(PrefixAlias)
-                a.Parent = c
-                a.Cqz = c.Cqz
-                a.Ituz = c.Ituz
-                s := strings.TrimSpace(v)
-                i := reEndPrefix.FindStringIndex(s)
-                prefix := s
-                if len(i) > 0 {
-                    prefix = s[:i[0]]
-                    if z := reGetCQZ.FindStringSubmatch(s); z != nil {
-                        if cqz, err := strconv.ParseInt(z[1], 10, 32); err == nil {
-                            a.Cqz = int(cqz)
-                        }
-                    }
-                    if y := reGetITUZ.FindStringSubmatch(s); y != nil {
-                        if ituz, err := strconv.ParseInt(y[1], 10, 32); err == nil {
-                            a.Ituz = int(ituz)
-                        }
-                    }
+            if c == nil {
+                err = fmt.Errorf("prefix line before any country line: '%s'", line)
+                return
+            }
+            if c.WAE && !includeWAE {
+                if isLastPrefixLine {
+                    countryNum++
                 }
-                a.Prefix = prefix
-                aliases[prefix] = *a
+                continue
+            }
+            for _, v := range prefixes {
+                b.addAlias(c, v)
             }
         }
 
         if isLastPrefixLine {
 			countryNum++
 			c.CountryNum = countryNum
-            countries[c.PrimaryPrefix] = *c
-            countriesByNo[c.CountryNum] = *c
+            b.addCountry(c)
         }
     }
-    return
+    if err = scan.Err(); err != nil {
+        return
+    }
+    return b.database()
 }
 
 
-// Truncate call until it corresponds to a Prefix in the database
-func iteratePrefix(call string) (prefix string, ok bool) {
-
-    ok = true
-    prefix = call
-    for len(prefix) > 0 {
-        if _, found := prefixes[prefix]; found {
-            return
-        }
-        prefix = strings.Replace(prefix, " ", "", -1)
-        prefix = prefix[:len(prefix) - 1]
-    }
-    ok = false
-    return
+// Longest prefix of the call found in the database
+func (db *Database) iteratePrefix(call string) (prefix string, ok bool) {
+    return db.trie.longest(call)
 }
 
 
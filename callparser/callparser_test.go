@@ -1,6 +1,9 @@
 package callparser
 
-import "testing"
+import (
+    "strings"
+    "testing"
+)
 
 func TestAllPropertiesWithValidCall(t *testing.T) {
     assertEqual(t, NewStation("HC2/DH1TW/P").Prefix, "HC")
@@ -206,3 +209,66 @@ func sbValid(t *testing.T, station *Station) {
 }
 
 
+
+func TestLoad(t *testing.T) {
+    db, err := Load("cty.dat")
+    if err != nil {
+        t.Fatal(err)
+    }
+    assertEqual(t, db.NewStation("DH1TW").Country, "Fed. Rep. of Germany")
+    if _, err := Load("missing.dat"); err == nil {
+        t.Errorf("Load of a missing file should fail")
+    }
+    if _, err := loadCtyMap(strings.NewReader("not a cty file"), false); err == nil {
+        t.Errorf("Load of a malformed file should fail")
+    }
+}
+
+func TestExactCallExceptions(t *testing.T) {
+    assertEqual(t, NewStation("3D2CR").Country, "Conway Reef")
+    assertEqual(t, NewStation("3D2CR").PrimaryPrefix, "3D2/c")
+    sbValid(t, NewStation("3D2CR"))
+    assertEqual(t, NewStation("3D2CA").Country, "Fiji")
+    assertEqual(t, NewStation("K0ESQ").Country, "Alaska")
+    assertEqual(t, NewStation("K0ESQ/P").Country, "Alaska")
+    assertEqual(t, NewStation("K0ESQ-#").Country, "Alaska")
+    assertEqual(t, NewStation("K0ESQ/KH6").Country, "Hawaii")
+    assertEqual(t, NewStation("K0ESQ/MM").Country, "")
+    assertEqual(t, NewStation("KL7DJ").Cqz, 3)
+    assertEqual(t, NewStation("KL7DJ").Ituz, 6)
+    assertEqual(t, NewStation("DP0GVN").Cqz, 38)
+}
+
+func TestPerEntryOverrides(t *testing.T) {
+    db, err := loadCtyMap(strings.NewReader(
+        "United States:            05:  08:  NA:   37.53:    91.67:     5.0:  K:\n" +
+        "    K,W,KH6(31)[61]<21.30/157.80>{OC}~10.0~,=W1AW/KH9<19.28/-166.63>{OC}~-12.0~;\n"), false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := db.NewStation("KH6ABC")
+    assertEqual(t, s.Country, "United States")
+    assertEqual(t, s.Cqz, 31)
+    assertEqual(t, s.Ituz, 61)
+    assertEqual(t, s.Latitude, float32(21.30))
+    assertEqual(t, s.Longitude, float32(157.80))
+    assertEqual(t, s.Continent, "OC")
+    assertEqual(t, s.Offset, float32(10.0))
+    s = db.NewStation("W1AW/KH9")
+    assertEqual(t, s.Prefix, "W1AW/KH9")
+    assertEqual(t, s.Cqz, 5)
+    assertEqual(t, s.Latitude, float32(19.28))
+    assertEqual(t, s.Offset, float32(-12.0))
+    s = db.NewStation("K1ABC")
+    assertEqual(t, s.Latitude, float32(37.53))
+    assertEqual(t, s.Continent, "NA")
+}
+
+func TestEditDistance(t *testing.T) {
+    assertEqual(t, EditDistance("K1ABC", "K1ABC"), 0)
+    assertEqual(t, EditDistance("K1ABC", "K1ABE"), 1)
+    assertEqual(t, EditDistance("K1ABC", "K1AB"), 1)
+    assertEqual(t, EditDistance("K1ABC", "KK1ABC"), 1)
+    assertEqual(t, EditDistance("DH1TW", "DL1TV"), 2)
+    assertEqual(t, EditDistance("", "K1A"), 3)
+}
@@ -0,0 +1,309 @@
+package callparser
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ClubLog resolves calls against the Club Log cty.xml, where entities, prefixes, call exceptions,
+// invalid operations and zone exceptions each carry an optional validity period.  Longitudes are
+// converted to the cty.dat convention (positive west).
+type ClubLog struct {
+	Date       string
+	entities   map[int]clubLogEntity
+	exceptions map[string][]clubLogEntry
+	prefixes   map[string][]clubLogEntry
+	invalid    map[string][]period
+	zones      map[string][]clubLogZone
+}
+
+type clubLogXML struct {
+	Date       string          `xml:"date,attr"`
+	Entities   []clubLogEntity `xml:"entities>entity"`
+	Exceptions []clubLogRecord `xml:"exceptions>exception"`
+	Prefixes   []clubLogRecord `xml:"prefixes>prefix"`
+	Invalid    []clubLogRecord `xml:"invalid_operations>invalid"`
+	Zones      []clubLogRecord `xml:"zone_exceptions>zone_exception"`
+}
+
+type clubLogEntity struct {
+	Adif    int     `xml:"adif"`
+	Name    string  `xml:"name"`
+	Prefix  string  `xml:"prefix"`
+	Deleted bool    `xml:"deleted"`
+	Cqz     int     `xml:"cqz"`
+	Cont    string  `xml:"cont"`
+	Long    float32 `xml:"long"`
+	Lat     float32 `xml:"lat"`
+	Start   string  `xml:"start"`
+	End     string  `xml:"end"`
+}
+
+type clubLogRecord struct {
+	Call   string  `xml:"call"`
+	Entity string  `xml:"entity"`
+	Adif   int     `xml:"adif"`
+	Cqz    int     `xml:"cqz"`
+	Zone   int     `xml:"zone"`
+	Cont   string  `xml:"cont"`
+	Long   float32 `xml:"long"`
+	Lat    float32 `xml:"lat"`
+	Start  string  `xml:"start"`
+	End    string  `xml:"end"`
+}
+
+type clubLogEntry struct {
+	adif int
+	cqz  int
+	cont string
+	lat  float32
+	long float32
+	period
+}
+
+type clubLogZone struct {
+	zone int
+	period
+}
+
+// Validity period, a zero start or end is open ended.
+type period struct {
+	start time.Time
+	end   time.Time
+}
+
+func (p period) contains(t time.Time) bool {
+	return (p.start.IsZero() || !t.Before(p.start)) && (p.end.IsZero() || !t.After(p.end))
+}
+
+func parsePeriod(start, end string) (p period, err error) {
+
+	if start != "" {
+		if p.start, err = time.Parse(time.RFC3339, start); err != nil {
+			return
+		}
+	}
+	if end != "" {
+		p.end, err = time.Parse(time.RFC3339, end)
+	}
+	return
+}
+
+var defaultClubLog atomic.Value
+
+// LoadClubLog reads a Club Log cty.xml file, gzipped if the name ends in .gz.
+func LoadClubLog(path string) (*ClubLog, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load %s: %v", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	cl, err := loadClubLog(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load %s: %v", path, err)
+	}
+	return cl, nil
+}
+
+func loadClubLog(r io.Reader) (*ClubLog, error) {
+
+	var doc clubLogXML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Entities) == 0 {
+		return nil, fmt.Errorf("no entities found")
+	}
+	cl := &ClubLog{
+		Date:       doc.Date,
+		entities:   make(map[int]clubLogEntity, len(doc.Entities)),
+		exceptions: make(map[string][]clubLogEntry, len(doc.Exceptions)),
+		prefixes:   make(map[string][]clubLogEntry, len(doc.Prefixes)),
+		invalid:    make(map[string][]period, len(doc.Invalid)),
+		zones:      make(map[string][]clubLogZone, len(doc.Zones)),
+	}
+	for _, e := range doc.Entities {
+		cl.entities[e.Adif] = e
+	}
+	for _, list := range []struct {
+		records []clubLogRecord
+		dest    map[string][]clubLogEntry
+	}{{doc.Exceptions, cl.exceptions}, {doc.Prefixes, cl.prefixes}} {
+		for _, rec := range list.records {
+			p, err := parsePeriod(rec.Start, rec.End)
+			if err != nil {
+				return nil, fmt.Errorf("bad date for %s: %v", rec.Call, err)
+			}
+			call := strings.ToUpper(rec.Call)
+			list.dest[call] = append(list.dest[call], clubLogEntry{adif: rec.Adif, cqz: rec.Cqz, cont: rec.Cont,
+				lat: rec.Lat, long: -rec.Long, period: p})
+		}
+	}
+	for _, rec := range doc.Invalid {
+		p, err := parsePeriod(rec.Start, rec.End)
+		if err != nil {
+			return nil, fmt.Errorf("bad date for %s: %v", rec.Call, err)
+		}
+		call := strings.ToUpper(rec.Call)
+		cl.invalid[call] = append(cl.invalid[call], p)
+	}
+	for _, rec := range doc.Zones {
+		p, err := parsePeriod(rec.Start, rec.End)
+		if err != nil {
+			return nil, fmt.Errorf("bad date for %s: %v", rec.Call, err)
+		}
+		call := strings.ToUpper(rec.Call)
+		cl.zones[call] = append(cl.zones[call], clubLogZone{zone: rec.Zone, period: p})
+	}
+	return cl, nil
+}
+
+// NewStationAt resolves a call to the DXCC entity valid at time t.  The call is first decoded with
+// the default country database to find the home call, designators and which part of the call
+// carries the prefix.
+func (cl *ClubLog) NewStationAt(input string, t time.Time) *Station {
+
+	p := Default().NewStation(input)
+	s := &Station{Call: p.Call, Homecall: p.Homecall, CallArea: p.CallArea, Mm: p.Mm, Am: p.Am, Beacon: p.Beacon,
+		db: p.db}
+	call := reRemoveDashSuffix.ReplaceAllString(s.Call, "")
+	for _, v := range cl.invalid[call] {
+		if v.contains(t) {
+			return s
+		}
+	}
+	if s.Mm || s.Am {
+		s.Valid = p.Valid
+		return s
+	}
+
+	if e, ok := cl.exceptionAt(call, t); ok {
+		s.Prefix = call
+		cl.setEntity(s, e)
+	} else if prefix, e, ok := cl.prefixAt(prefixSource(p), t); ok {
+		s.Prefix = prefix
+		cl.setEntity(s, e)
+	}
+	if s.Valid {
+		for _, z := range cl.zones[call] {
+			if z.contains(t) {
+				s.Cqz = z.zone
+				break
+			}
+		}
+	}
+	return s
+}
+
+// Exceptions match the full call, then again with portable style designators removed.
+func (cl *ClubLog) exceptionAt(call string, t time.Time) (clubLogEntry, bool) {
+
+	for {
+		for _, e := range cl.exceptions[call] {
+			if e.contains(t) {
+				return e, true
+			}
+		}
+		i := strings.LastIndex(call, "/")
+		if i < 0 {
+			break
+		}
+		switch call[i+1:] {
+		case "P", "M", "QRP", "QRPP", "LH":
+			call = call[:i]
+		default:
+			return clubLogEntry{}, false
+		}
+	}
+	return clubLogEntry{}, false
+}
+
+// Longest prefix valid at time t.
+func (cl *ClubLog) prefixAt(call string, t time.Time) (string, clubLogEntry, bool) {
+
+	for prefix := call; len(prefix) > 0; prefix = prefix[:len(prefix)-1] {
+		for _, e := range cl.prefixes[prefix] {
+			if e.contains(t) {
+				return prefix, e, true
+			}
+		}
+	}
+	return "", clubLogEntry{}, false
+}
+
+func (cl *ClubLog) setEntity(s *Station, e clubLogEntry) {
+
+	ent, ok := cl.entities[e.adif]
+	if !ok {
+		return
+	}
+	s.Valid = true
+	s.Dxcc = ent.Adif
+	s.Country = ent.Name
+	s.PrimaryPrefix = ent.Prefix
+	s.Cqz, s.Continent, s.Latitude, s.Longitude = ent.Cqz, ent.Cont, ent.Lat, -ent.Long
+	if e.cqz != 0 {
+		s.Cqz = e.cqz
+	}
+	if e.cont != "" {
+		s.Continent = e.cont
+	}
+	if e.lat != 0 || e.long != 0 {
+		s.Latitude, s.Longitude = e.lat, e.long
+	}
+	// Club Log has no ITU zones or UTC offsets, borrow them from cty.dat where the entity matches
+	if c, ok := s.db.LookupCountry(ent.Prefix); ok {
+		s.Ituz = c.Ituz
+		s.Offset = c.Offset
+	}
+}
+
+// The part of the call that carries the prefix according to the cty.dat decode, i.e. VP5 for
+// VP5/DH1TW or KH6 for K1ABC/KH6.
+func prefixSource(p *Station) string {
+
+	call := reRemoveDashSuffix.ReplaceAllString(p.Call, "")
+	segments := strings.Split(call, "/")
+	if p.Prefix != "" {
+		for _, seg := range segments {
+			if strings.HasPrefix(seg, p.Prefix) {
+				return seg
+			}
+		}
+	}
+	if p.Homecall != "" {
+		return p.Homecall
+	}
+	return segments[0]
+}
+
+// SetClubLog installs the Club Log data used by the package level NewStationAt.
+func SetClubLog(cl *ClubLog) {
+	defaultClubLog.Store(cl)
+}
+
+// NewStationAt resolves a call as of time t using the Club Log data installed with SetClubLog,
+// falling back to the default country database (which has no notion of time) otherwise.
+func NewStationAt(input string, t time.Time) *Station {
+
+	if cl, ok := defaultClubLog.Load().(*ClubLog); ok && cl != nil {
+		return cl.NewStationAt(input, t)
+	}
+	return NewStation(input)
+}
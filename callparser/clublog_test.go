@@ -0,0 +1,77 @@
+package callparser
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const clubLogSample = `<?xml version="1.0" encoding="UTF-8"?>
+<clublog date="2021-10-13T08:00:00+00:00" xmlns="https://clublog.org/cty/v1.2">
+<entities>
+ <entity><adif>1</adif><name>CANADA</name><prefix>VE</prefix><deleted>false</deleted><cqz>5</cqz><cont>NA</cont><long>-80.00</long><lat>45.00</lat></entity>
+ <entity><adif>13</adif><name>ANTARCTICA</name><prefix>CE9</prefix><deleted>false</deleted><cqz>13</cqz><cont>SA</cont><long>0.00</long><lat>-90.00</lat></entity>
+ <entity><adif>23</adif><name>BLENHEIM REEF</name><prefix>1B</prefix><deleted>true</deleted><cqz>13</cqz><cont>AF</cont><long>10.00</long><lat>1.00</lat><end>1991-12-31T23:59:59+00:00</end></entity>
+ <entity><adif>291</adif><name>UNITED STATES OF AMERICA</name><prefix>K</prefix><deleted>false</deleted><cqz>5</cqz><cont>NA</cont><long>-91.67</long><lat>37.53</lat></entity>
+ <entity><adif>77</adif><name>NEWFOUNDLAND</name><prefix>VO</prefix><deleted>true</deleted><cqz>5</cqz><cont>NA</cont><long>-53.00</long><lat>48.00</lat><end>1949-03-31T23:59:59+00:00</end></entity>
+</entities>
+<exceptions>
+ <exception record="1"><call>KC6BN</call><entity>ANTARCTICA</entity><adif>13</adif><cqz>13</cqz><cont>SA</cont><long>-64.00</long><lat>-65.00</lat><start>1990-01-01T00:00:00+00:00</start><end>1990-12-31T23:59:59+00:00</end></exception>
+</exceptions>
+<prefixes>
+ <prefix record="1"><call>VE</call><entity>CANADA</entity><adif>1</adif><cqz>5</cqz><cont>NA</cont><long>-80.00</long><lat>45.00</lat></prefix>
+ <prefix record="2"><call>VO</call><entity>NEWFOUNDLAND</entity><adif>77</adif><cqz>5</cqz><cont>NA</cont><long>-53.00</long><lat>48.00</lat><end>1949-03-31T23:59:59+00:00</end></prefix>
+ <prefix record="3"><call>VO</call><entity>CANADA</entity><adif>1</adif><cqz>5</cqz><cont>NA</cont><long>-53.00</long><lat>48.00</lat><start>1949-04-01T00:00:00+00:00</start></prefix>
+ <prefix record="4"><call>K</call><entity>UNITED STATES OF AMERICA</entity><adif>291</adif><cqz>5</cqz><cont>NA</cont><long>-91.67</long><lat>37.53</lat></prefix>
+ <prefix record="5"><call>KC6</call><entity>UNITED STATES OF AMERICA</entity><adif>291</adif><cqz></cqz><cont></cont><long></long><lat></lat></prefix>
+</prefixes>
+<invalid_operations>
+ <invalid record="1"><call>K1BAD</call><start>2020-01-01T00:00:00+00:00</start><end>2020-12-31T23:59:59+00:00</end></invalid>
+</invalid_operations>
+<zone_exceptions>
+ <zone_exception record="1"><call>VE8ABC</call><zone>2</zone><start>2015-01-01T00:00:00+00:00</start></zone_exception>
+</zone_exceptions>
+</clublog>`
+
+func TestClubLog(t *testing.T) {
+
+	cl, err := loadClubLog(strings.NewReader(clubLogSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	s := cl.NewStationAt("KC6BN", at("1990-06-01"))
+	sbValid(t, s)
+	assertEqual(t, s.Country, "ANTARCTICA")
+	assertEqual(t, s.Dxcc, 13)
+	assertEqual(t, s.Longitude, float32(64.00))
+	s = cl.NewStationAt("KC6BN", at("2021-06-01"))
+	assertEqual(t, s.Country, "UNITED STATES OF AMERICA")
+	assertEqual(t, s.Prefix, "KC6")
+	assertEqual(t, s.Cqz, 5)
+	assertEqual(t, s.Latitude, float32(37.53))
+
+	assertEqual(t, cl.NewStationAt("VO1AW", at("1948-01-01")).Country, "NEWFOUNDLAND")
+	assertEqual(t, cl.NewStationAt("VO1AW", at("1950-01-01")).Country, "CANADA")
+	assertEqual(t, cl.NewStationAt("VO1AW", at("1950-01-01")).Dxcc, 1)
+
+	sbInvalid(t, cl.NewStationAt("K1BAD", at("2020-06-01")))
+	sbValid(t, cl.NewStationAt("K1BAD", at("2021-06-01")))
+
+	assertEqual(t, cl.NewStationAt("VE8ABC", at("2014-06-01")).Cqz, 5)
+	assertEqual(t, cl.NewStationAt("VE8ABC", at("2016-06-01")).Cqz, 2)
+	assertEqual(t, cl.NewStationAt("VE3/K1ABC", at("2016-06-01")).Country, "CANADA")
+	assertEqual(t, cl.NewStationAt("K1ABC/MM", at("2016-06-01")).Country, "")
+	sbInvalid(t, cl.NewStationAt("DL1ABC", at("2016-06-01")))
+}
+
+func TestNewStationAtFallback(t *testing.T) {
+	assertEqual(t, NewStationAt("DH1TW", time.Now()).Country, "Fed. Rep. of Germany")
+}
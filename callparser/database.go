@@ -0,0 +1,79 @@
+package callparser
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Copy of cty.dat compiled into the binary, used when no file is given.
+//
+//go:embed cty.dat
+var embeddedCty []byte
+
+// Database holds the country and prefix tables loaded from a cty.dat file.  A Database is never
+// modified after loading, reloads build a new one and swap it in.
+type Database struct {
+	countries     map[string]CountryInfo
+	countriesByNo map[int]CountryInfo
+	prefixes      map[string]PrefixAlias
+	calls         map[string]PrefixAlias
+	trie          *prefixTrie
+	version       string
+	adif          bool
+}
+
+var (
+	defaultDB   atomic.Value
+	defaultOnce sync.Once
+)
+
+// Load reads a country file, guessing the format from its name.
+func Load(path string) (*Database, error) {
+	return LoadFormat(path, DetectFormat(path))
+}
+
+// LoadEmbedded reads the copy of cty.dat compiled into the binary.
+func LoadEmbedded() (*Database, error) {
+
+	db, err := loadCtyMap(bytes.NewReader(embeddedCty), true)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load embedded cty.dat: %v", err)
+	}
+	return db, nil
+}
+
+// Version returns the release of the country file (i.e. VER20211013), empty if the file has none.
+func (db *Database) Version() string {
+	return db.version
+}
+
+// Default returns the database used by the package level functions.  Unless SetDefault was called
+// it is loaded from the embedded cty.dat on first use.
+func Default() *Database {
+
+	defaultOnce.Do(func() {
+		if defaultDB.Load() != nil {
+			return
+		}
+		db, err := LoadEmbedded()
+		if err != nil {
+			panic(err)
+		}
+		defaultDB.Store(db)
+	})
+	return defaultDB.Load().(*Database)
+}
+
+// SetDefault atomically replaces the database used by the package level functions.  Lookups
+// already in progress complete against the database they started with.
+func SetDefault(db *Database) {
+	defaultDB.Store(db)
+}
+
+// Version returns the release of the default country file.
+func Version() string {
+	return Default().Version()
+}
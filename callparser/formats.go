@@ -0,0 +1,244 @@
+package callparser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Format selects the country file layout to load.
+type Format int
+
+const (
+	// FormatDat is the classic cty.dat, including the WAE and CQ only entities flagged with '*'.
+	FormatDat Format = iota
+	// FormatDXCC is cty.dat with the '*' entities left out, so calls resolve to DXCC entities only.
+	FormatDXCC
+	// FormatWTMod is the Win-Test cty_wt_mod.dat.
+	FormatWTMod
+	// FormatWAE is wae_cty.dat, splitting out WAE entities such as IT9 and GM/s.
+	FormatWAE
+	// FormatCSV is cty.csv, which carries ADIF DXCC entity codes.
+	FormatCSV
+)
+
+var formatNames = map[Format]string{
+	FormatDat:   "dat",
+	FormatDXCC:  "dxcc",
+	FormatWTMod: "wt_mod",
+	FormatWAE:   "wae",
+	FormatCSV:   "csv",
+}
+
+// Names of the files as distributed by AD1C.
+var formatFiles = map[Format]string{
+	FormatDat:   "cty.dat",
+	FormatDXCC:  "cty.dat",
+	FormatWTMod: "cty_wt_mod.dat",
+	FormatWAE:   "wae_cty.dat",
+	FormatCSV:   "cty.csv",
+}
+
+func (f Format) String() string {
+	return formatNames[f]
+}
+
+// FileName returns the usual name of a file in this format.
+func (f Format) FileName() string {
+	return formatFiles[f]
+}
+
+// ParseFormat converts a format name (dat, dxcc, wt_mod, wae, csv) to a Format.  An empty name is FormatDat.
+func ParseFormat(name string) (Format, error) {
+
+	if name == "" {
+		return FormatDat, nil
+	}
+	for f, n := range formatNames {
+		if strings.EqualFold(n, name) {
+			return f, nil
+		}
+	}
+	return FormatDat, fmt.Errorf("unknown country file format '%s'", name)
+}
+
+// DetectFormat guesses the format from the file name.
+func DetectFormat(path string) Format {
+
+	base := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(base, ".csv"):
+		return FormatCSV
+	case strings.Contains(base, "wae"):
+		return FormatWAE
+	case strings.Contains(base, "wt"):
+		return FormatWTMod
+	}
+	return FormatDat
+}
+
+// LoadFormat reads a country file in the given format.
+func LoadFormat(path string, format Format) (*Database, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db, err := loadFormat(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load %s: %v", path, err)
+	}
+	return db, nil
+}
+
+func loadFormat(r io.Reader, format Format) (*Database, error) {
+
+	switch format {
+	case FormatCSV:
+		return loadCtyCSV(r)
+	case FormatDXCC:
+		return loadCtyMap(r, false)
+	}
+	return loadCtyMap(r, true)
+}
+
+// cty.csv has one entity per line: primary prefix, name, ADIF code, continent, CQ zone, ITU zone,
+// latitude, longitude, UTC offset and a space separated prefix list terminated by ';'.
+func loadCtyCSV(r io.Reader) (*Database, error) {
+
+	b := newCtyBuilder()
+	b.adif = true
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 10
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c := new(CountryInfo)
+		c.PrimaryPrefix = strings.TrimSpace(rec[0])
+		if strings.HasPrefix(c.PrimaryPrefix, "*") {
+			c.PrimaryPrefix = c.PrimaryPrefix[1:]
+			c.WAE = true
+		}
+		c.Country = strings.TrimSpace(rec[1])
+		if c.CountryNum, err = strconv.Atoi(strings.TrimSpace(rec[2])); err != nil {
+			return nil, fmt.Errorf("bad DXCC code for %s: %v", c.Country, err)
+		}
+		c.Continent = strings.TrimSpace(rec[3])
+		c.Cqz, _ = strconv.Atoi(strings.TrimSpace(rec[4]))
+		c.Ituz, _ = strconv.Atoi(strings.TrimSpace(rec[5]))
+		if v, err := strconv.ParseFloat(strings.TrimSpace(rec[6]), 32); err == nil {
+			c.Latitude = float32(v)
+		}
+		if v, err := strconv.ParseFloat(strings.TrimSpace(rec[7]), 32); err == nil {
+			c.Longitude = float32(v)
+		}
+		if v, err := strconv.ParseFloat(strings.TrimSpace(rec[8]), 32); err == nil {
+			c.Offset = float32(v)
+		}
+		for _, v := range strings.Fields(strings.TrimSuffix(strings.TrimSpace(rec[9]), ";")) {
+			b.addAlias(c, v)
+		}
+		b.addCountry(c)
+	}
+	return b.database()
+}
+
+// Accumulates entities and prefixes, independent of the file layout.
+type ctyBuilder struct {
+	countries     map[string]CountryInfo
+	countriesByNo map[int]CountryInfo
+	aliases       map[string]PrefixAlias
+	calls         map[string]PrefixAlias
+	version       string
+	adif          bool
+}
+
+func newCtyBuilder() *ctyBuilder {
+
+	return &ctyBuilder{
+		countries:     make(map[string]CountryInfo),
+		countriesByNo: make(map[int]CountryInfo),
+		aliases:       make(map[string]PrefixAlias),
+		calls:         make(map[string]PrefixAlias),
+	}
+}
+
+func (b *ctyBuilder) addCountry(c *CountryInfo) {
+
+	b.countries[c.PrimaryPrefix] = *c
+	// WAE entities share the ADIF code of their DXCC parent
+	if _, found := b.countriesByNo[c.CountryNum]; !found || !c.WAE {
+		b.countriesByNo[c.CountryNum] = *c
+	}
+}
+
+// Add a prefix or =CALL token, applying any (cq)[itu]<lat/lon>{cont}~offset~ overrides.
+func (b *ctyBuilder) addAlias(c *CountryInfo, token string) {
+
+	s := strings.TrimSpace(token)
+	if s == "" {
+		return
+	}
+	a := PrefixAlias{Parent: c, Cqz: c.Cqz, Ituz: c.Ituz, Latitude: c.Latitude, Longitude: c.Longitude,
+		Continent: c.Continent, Offset: c.Offset}
+	prefix := s
+	if i := reEndPrefix.FindStringIndex(s); len(i) > 0 {
+		prefix = s[:i[0]]
+		if z := reGetCQZ.FindStringSubmatch(s); z != nil {
+			if cqz, err := strconv.ParseInt(z[1], 10, 32); err == nil {
+				a.Cqz = int(cqz)
+			}
+		}
+		if y := reGetITUZ.FindStringSubmatch(s); y != nil {
+			if ituz, err := strconv.ParseInt(y[1], 10, 32); err == nil {
+				a.Ituz = int(ituz)
+			}
+		}
+		if ll := reGetLatLon.FindStringSubmatch(s); ll != nil {
+			lat, err1 := strconv.ParseFloat(ll[1], 32)
+			lon, err2 := strconv.ParseFloat(ll[2], 32)
+			if err1 == nil && err2 == nil {
+				a.Latitude = float32(lat)
+				a.Longitude = float32(lon)
+			}
+		}
+		if cont := reGetCont.FindStringSubmatch(s); cont != nil {
+			a.Continent = cont[1]
+		}
+		if o := reGetOffset.FindStringSubmatch(s); o != nil {
+			if offset, err := strconv.ParseFloat(o[1], 32); err == nil {
+				a.Offset = float32(offset)
+			}
+		}
+	}
+	if reVersion.MatchString(prefix) {
+		b.version = prefix[1:]
+	}
+	if strings.HasPrefix(prefix, "=") {
+		a.Exact = true
+		a.Prefix = prefix[1:]
+		b.calls[a.Prefix] = a
+		return
+	}
+	a.Prefix = prefix
+	b.aliases[prefix] = a
+}
+
+func (b *ctyBuilder) database() (*Database, error) {
+
+	if len(b.countries) == 0 {
+		return nil, fmt.Errorf("no countries found")
+	}
+	return &Database{countries: b.countries, countriesByNo: b.countriesByNo, prefixes: b.aliases,
+		calls: b.calls, trie: newPrefixTrie(b.aliases), version: b.version, adif: b.adif}, nil
+}
@@ -0,0 +1,95 @@
+package callparser
+
+import (
+	"strings"
+	"testing"
+)
+
+const waeSample = `Italy:                    15:  28:  EU:   42.82:   -12.58:    -1.0:  I:
+    I,IK,IZ;
+Sicily:                   15:  28:  EU:   37.50:   -14.00:    -1.0:  *IT9:
+    IT9,IW9;
+`
+
+const csvSample = `1A,Sov Mil Order of Malta,246,EU,15,28,41.90,-12.43,-1.0,1A;
+3D2,Fiji,176,OC,32,56,-17.78,-177.92,-12.0,3D2;
+3D2/c,Conway Reef,489,OC,32,56,-22.00,-175.00,-12.0,=3D2CR;
+I,Italy,248,EU,15,28,42.82,-12.58,-1.0,I IK IZ;
+*IT9,Sicily,248,EU,15,28,37.50,-14.00,-1.0,IT9 IW9(15)[28];
+`
+
+func TestWAEVariant(t *testing.T) {
+
+	dxcc, err := loadFormat(strings.NewReader(waeSample), FormatDXCC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, dxcc.NewStation("IT9ABC").Country, "Italy")
+	if _, ok := dxcc.LookupCountry("IT9"); ok {
+		t.Errorf("WAE entity should not be loaded for DXCC")
+	}
+
+	for _, format := range []Format{FormatDat, FormatWAE} {
+		wae, err := loadFormat(strings.NewReader(waeSample), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, wae.NewStation("IT9ABC").Country, "Sicily")
+		assertEqual(t, wae.NewStation("IT9ABC").PrimaryPrefix, "IT9")
+		assertEqual(t, wae.NewStation("IK2ABC").Country, "Italy")
+		c, ok := wae.LookupCountry("IT9")
+		assertEqual(t, ok, true)
+		assertEqual(t, c.WAE, true)
+		assertEqual(t, c.CountryNum, 2)
+	}
+}
+
+func TestEmbeddedKeepsWAE(t *testing.T) {
+
+	db, err := LoadEmbedded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, db.NewStation("IT9ABC").Country, "Sicily")
+	c, ok := db.LookupCountry("4U1V")
+	assertEqual(t, ok, true)
+	assertEqual(t, c.Country, "Vienna Intl Ctr")
+}
+
+func TestCSV(t *testing.T) {
+
+	db, err := loadFormat(strings.NewReader(csvSample), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, db.NewStation("3D2AB").Country, "Fiji")
+	assertEqual(t, db.NewStation("3D2CR").Country, "Conway Reef")
+	assertEqual(t, db.NewStation("3D2CR").Dxcc, 489)
+	assertEqual(t, db.NewStation("IT9ABC").Country, "Sicily")
+	c, ok := db.LookupCountry("3D2")
+	assertEqual(t, ok, true)
+	assertEqual(t, c.CountryNum, 176)
+	c, ok = db.LookupCountryByNo(248)
+	assertEqual(t, ok, true)
+	assertEqual(t, c.Country, "Italy")
+	c, ok = db.LookupCountryByNo(246)
+	assertEqual(t, ok, true)
+	assertEqual(t, c.PrimaryPrefix, "1A")
+
+	if _, err := loadFormat(strings.NewReader("1A,Malta,xx,EU,15,28,41.90,-12.43,-1.0,1A;\n"), FormatCSV); err == nil {
+		t.Errorf("Bad DXCC code should fail")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	assertEqual(t, DetectFormat("/tmp/cty.dat"), FormatDat)
+	assertEqual(t, DetectFormat("/tmp/cty.csv"), FormatCSV)
+	assertEqual(t, DetectFormat("wae_cty.dat"), FormatWAE)
+	assertEqual(t, DetectFormat("cty_wt_mod.dat"), FormatWTMod)
+	f, err := ParseFormat("wae")
+	assertEqual(t, err, nil)
+	assertEqual(t, f, FormatWAE)
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Errorf("Unknown format should fail")
+	}
+}
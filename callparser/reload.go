@@ -0,0 +1,207 @@
+package callparser
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Country files with fewer entities than this are assumed to be truncated and are rejected by Update.
+const minCountries = 300
+
+// Reloader keeps the default database in step with a country file on disk and optionally
+// refreshes that file from an update URL.
+type Reloader struct {
+	Path      string
+	Format    Format
+	UpdateURL string
+	Client    *http.Client
+	mu        sync.Mutex
+	modTime   time.Time
+}
+
+// NewReloader loads the file at path and installs it as the default database.  With no path the
+// embedded cty.dat stays in place, restricted to DXCC entities if format is FormatDXCC.
+func NewReloader(path, updateURL string, format Format) (*Reloader, error) {
+
+	r := &Reloader{Path: path, Format: format, UpdateURL: updateURL, Client: &http.Client{Timeout: time.Minute}}
+	if path == "" {
+		if format == FormatDXCC {
+			db, err := loadFormat(bytes.NewReader(embeddedCty), format)
+			if err != nil {
+				return nil, fmt.Errorf("cannot load embedded cty.dat: %v", err)
+			}
+			SetDefault(db)
+		}
+		return r, nil
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the file and swaps it in as the default database.  On error the current database
+// stays in place.
+func (r *Reloader) Reload() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Path == "" {
+		return nil
+	}
+	fi, err := os.Stat(r.Path)
+	if err != nil {
+		return err
+	}
+	db, err := LoadFormat(r.Path, r.Format)
+	if err != nil {
+		return err
+	}
+	r.modTime = fi.ModTime()
+	SetDefault(db)
+	log.Printf("Loaded country file %s version %s.", r.Path, db.Version())
+	return nil
+}
+
+// Check reloads the file if its modification time changed since the last load.
+func (r *Reloader) Check() error {
+
+	if r.Path == "" {
+		return nil
+	}
+	fi, err := os.Stat(r.Path)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	changed := !fi.ModTime().Equal(r.modTime)
+	r.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return r.Reload()
+}
+
+// Update fetches a country file from UpdateURL (plain or zipped), validates it, writes it to
+// Path and swaps it in.  Without a Path the new database is only held in memory.
+func (r *Reloader) Update() error {
+
+	if r.UpdateURL == "" {
+		return fmt.Errorf("no update URL")
+	}
+	resp, err := r.Client.Get(r.UpdateURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("update from %s: %v", r.UpdateURL, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if body, err = unzipCty(body, r.Format.FileName()); err != nil {
+		return err
+	}
+	db, err := loadFormat(bytes.NewReader(body), r.Format)
+	if err != nil {
+		return fmt.Errorf("update from %s: %v", r.UpdateURL, err)
+	}
+	if len(db.countries) < minCountries {
+		return fmt.Errorf("update from %s: only %d countries", r.UpdateURL, len(db.countries))
+	}
+	if cur := Default().Version(); db.Version() != "" && db.Version() == cur {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Path != "" {
+		tmp, err := ioutil.TempFile(filepath.Dir(r.Path), ".cty-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.Write(body); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), r.Path); err != nil {
+			return err
+		}
+		if fi, err := os.Stat(r.Path); err == nil {
+			r.modTime = fi.ModTime()
+		}
+	}
+	SetDefault(db)
+	log.Printf("Updated country file from %s to version %s.", r.UpdateURL, db.Version())
+	return nil
+}
+
+// Run polls the file for changes every checkInterval and fetches updates every updateInterval
+// until stop is closed.  A zero interval disables that activity.
+func (r *Reloader) Run(checkInterval, updateInterval time.Duration, stop <-chan struct{}) {
+
+	var check, update <-chan time.Time
+	if checkInterval > 0 && r.Path != "" {
+		t := time.NewTicker(checkInterval)
+		defer t.Stop()
+		check = t.C
+	}
+	if updateInterval > 0 && r.UpdateURL != "" {
+		t := time.NewTicker(updateInterval)
+		defer t.Stop()
+		update = t.C
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-check:
+			if err := r.Check(); err != nil {
+				log.Printf("Country file reload failed: %v", err)
+			}
+		case <-update:
+			if err := r.Update(); err != nil {
+				log.Printf("Country file update failed: %v", err)
+			}
+		}
+	}
+}
+
+// AD1C distributes the country files together in a zip, pick out ours if that's what we got.
+func unzipCty(body []byte, name string) ([]byte, error) {
+
+	if !bytes.HasPrefix(body, []byte("PK")) {
+		return body, nil
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if !strings.EqualFold(filepath.Base(f.Name), name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("no %s in zip archive", name)
+}
@@ -0,0 +1,100 @@
+package callparser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVersion(t *testing.T) {
+	assertEqual(t, Default().Version(), "VER20211013")
+}
+
+func TestReloadOnChange(t *testing.T) {
+
+	defer SetDefault(Default())
+	dir, err := ioutil.TempDir("", "cty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cty.dat")
+	if err := ioutil.WriteFile(path, embeddedCty, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReloader(path, "", FormatDat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, NewStation("DH1TW").Country, "Fed. Rep. of Germany")
+
+	small := "Fed. Rep. of Germany:     14:  28:  EU:   51.00:   -10.00:    -1.0:  DL:\n    DL,=VER20990101;\n"
+	if err := ioutil.WriteFile(path, []byte(small), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Check(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, Version(), "VER20990101")
+	sbInvalid(t, NewStation("K1ABC"))
+
+	// A broken file leaves the current database in place
+	if err := ioutil.WriteFile(path, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Errorf("Reload of a broken file should fail")
+	}
+	assertEqual(t, Version(), "VER20990101")
+}
+
+func TestUpdate(t *testing.T) {
+
+	defer SetDefault(Default())
+	payload := []byte("garbage")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(payload)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "cty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cty.dat")
+	db, err := loadCtyMap(bytes.NewReader(embeddedCty), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.version = "VER20000101"
+	SetDefault(db)
+
+	r, err := NewReloader("", srv.URL, FormatDat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Path = path
+	if err := r.Update(); err == nil {
+		t.Errorf("Update with an invalid file should fail")
+	}
+	assertEqual(t, Version(), "VER20000101")
+
+	payload = embeddedCty
+	if err := r.Update(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, Version(), "VER20211013")
+	if b, err := ioutil.ReadFile(path); err != nil || len(b) != len(embeddedCty) {
+		t.Errorf("Updated file not written to %s: %v", path, err)
+	}
+}
@@ -0,0 +1,209 @@
+package callparser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SCP is a super check partial list (MASTER.SCP) of calls known to be active in contests.
+type SCP struct {
+	calls    map[string]struct{}
+	byLength map[int][]string
+	sorted   []string
+}
+
+// LoadSCP reads a MASTER.SCP file, one call per line, lines starting with # are comments.
+func LoadSCP(path string) (*SCP, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := loadSCP(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load %s: %v", path, err)
+	}
+	return s, nil
+}
+
+func loadSCP(r io.Reader) (*SCP, error) {
+
+	s := &SCP{calls: make(map[string]struct{}), byLength: make(map[int][]string)}
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		call := strings.ToUpper(strings.TrimSpace(scan.Text()))
+		if call == "" || strings.HasPrefix(call, "#") {
+			continue
+		}
+		if _, found := s.calls[call]; found {
+			continue
+		}
+		s.calls[call] = struct{}{}
+		s.byLength[len(call)] = append(s.byLength[len(call)], call)
+		s.sorted = append(s.sorted, call)
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	if len(s.calls) == 0 {
+		return nil, fmt.Errorf("no calls found")
+	}
+	sort.Strings(s.sorted)
+	return s, nil
+}
+
+// Len returns the number of calls in the list.
+func (s *SCP) Len() int {
+	return len(s.calls)
+}
+
+// Contains reports whether the call, or its home call if it has appendices, is in the list.
+func (s *SCP) Contains(call string) bool {
+
+	call = reRemoveDashSuffix.ReplaceAllString(strings.ToUpper(strings.TrimSpace(call)), "")
+	if _, found := s.calls[call]; found {
+		return true
+	}
+	if !strings.Contains(call, "/") {
+		return false
+	}
+	if home := Default().NewStation(call).Homecall; home != "" {
+		_, found := s.calls[home]
+		return found
+	}
+	return false
+}
+
+// Near returns the calls within maxDistance edits of call, closest first.
+func (s *SCP) Near(call string, maxDistance int) []string {
+
+	call = strings.ToUpper(strings.TrimSpace(call))
+	type candidate struct {
+		call     string
+		distance int
+	}
+	var found []candidate
+	for l := len(call) - maxDistance; l <= len(call)+maxDistance; l++ {
+		for _, c := range s.byLength[l] {
+			if d := EditDistance(call, c); d <= maxDistance {
+				found = append(found, candidate{c, d})
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].distance != found[j].distance {
+			return found[i].distance < found[j].distance
+		}
+		return found[i].call < found[j].call
+	})
+	near := make([]string, len(found))
+	for i, c := range found {
+		near[i] = c.call
+	}
+	return near
+}
+
+// Partial returns the calls containing fragment, in sorted order.
+func (s *SCP) Partial(fragment string) []string {
+
+	fragment = strings.ToUpper(strings.TrimSpace(fragment))
+	var matches []string
+	for _, c := range s.sorted {
+		if strings.Contains(c, fragment) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// SCPWatcher holds the current SCP list and reloads it when the file changes.
+type SCPWatcher struct {
+	Path    string
+	current atomic.Value
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// NewSCPWatcher loads the SCP file at path.
+func NewSCPWatcher(path string) (*SCPWatcher, error) {
+
+	w := &SCPWatcher{Path: path}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// SCP returns the current list.
+func (w *SCPWatcher) SCP() *SCP {
+	return w.current.Load().(*SCP)
+}
+
+// Contains checks the current list.
+func (w *SCPWatcher) Contains(call string) bool {
+	return w.SCP().Contains(call)
+}
+
+// Reload reads the file and swaps it in.  On error the current list stays in place.
+func (w *SCPWatcher) Reload() error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fi, err := os.Stat(w.Path)
+	if err != nil {
+		return err
+	}
+	s, err := LoadSCP(w.Path)
+	if err != nil {
+		return err
+	}
+	w.modTime = fi.ModTime()
+	w.current.Store(s)
+	log.Printf("Loaded %d calls from SCP file %s.", s.Len(), w.Path)
+	return nil
+}
+
+// Check reloads the file if its modification time changed since the last load.
+func (w *SCPWatcher) Check() error {
+
+	fi, err := os.Stat(w.Path)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	changed := !fi.ModTime().Equal(w.modTime)
+	w.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return w.Reload()
+}
+
+// Run checks the file for changes every interval until stop is closed.
+func (w *SCPWatcher) Run(interval time.Duration, stop <-chan struct{}) {
+
+	if interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if err := w.Check(); err != nil {
+				log.Printf("SCP reload failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package callparser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const scpSample = `# Sample MASTER.SCP
+K1ABC
+K1ABD
+DH1TW
+W3LPL
+w6xyz
+`
+
+func TestSCP(t *testing.T) {
+
+	s, err := loadSCP(strings.NewReader(scpSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, s.Len(), 5)
+	assertEqual(t, s.Contains("K1ABC"), true)
+	assertEqual(t, s.Contains("w6xyz"), true)
+	assertEqual(t, s.Contains("K1ABE"), false)
+	assertEqual(t, s.Contains("DH1TW/P"), true)
+	assertEqual(t, s.Contains("EA8/DH1TW"), true)
+	assertEqual(t, s.Contains("W3LPL-#"), true)
+	assertEqual(t, strings.Join(s.Near("K1ABE", 1), ","), "K1ABC,K1ABD")
+	assertEqual(t, strings.Join(s.Near("K1ABC", 1), ","), "K1ABC,K1ABD")
+	assertEqual(t, len(s.Near("JA1XYZ", 1)), 0)
+	assertEqual(t, strings.Join(s.Partial("1AB"), ","), "K1ABC,K1ABD")
+
+	if _, err := loadSCP(strings.NewReader("# empty\n")); err == nil {
+		t.Errorf("Empty SCP should fail")
+	}
+}
+
+func TestSCPWatcher(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "scp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "MASTER.SCP")
+	if err := ioutil.WriteFile(path, []byte(scpSample), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewSCPWatcher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, w.Contains("N7ZG"), false)
+
+	if err := ioutil.WriteFile(path, []byte("N7ZG\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Check(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, w.Contains("N7ZG"), true)
+	assertEqual(t, w.Contains("K1ABC"), false)
+}
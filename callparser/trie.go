@@ -0,0 +1,115 @@
+package callparser
+
+// Prefix trie over the characters that appear in callsigns.  Finding the longest matching prefix
+// is a single walk down the call.
+type prefixTrie struct {
+	root trieNode
+}
+
+type trieNode struct {
+	children [37]*trieNode
+	alias    *PrefixAlias
+}
+
+// Position of a callsign character in trieNode.children, -1 if it can't appear in a prefix.
+func trieIndex(c byte) int {
+
+	switch {
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A')
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26
+	case c == '/':
+		return 36
+	}
+	return -1
+}
+
+func newPrefixTrie(aliases map[string]PrefixAlias) *prefixTrie {
+
+	t := &prefixTrie{}
+	for prefix := range aliases {
+		a := aliases[prefix]
+		t.insert(prefix, &a)
+	}
+	return t
+}
+
+// Prefixes containing characters outside the trie alphabet are skipped.
+func (t *prefixTrie) insert(prefix string, a *PrefixAlias) {
+
+	n := &t.root
+	for i := 0; i < len(prefix); i++ {
+		x := trieIndex(prefix[i])
+		if x < 0 {
+			return
+		}
+		if n.children[x] == nil {
+			n.children[x] = &trieNode{}
+		}
+		n = n.children[x]
+	}
+	n.alias = a
+}
+
+// Walk the call calling fn for each prefix found, shortest first.  Spaces are ignored, any other
+// character outside the alphabet ends the walk.
+func (t *prefixTrie) walk(call string, fn func(prefix string, a *PrefixAlias)) {
+
+	n := &t.root
+	var buf [16]byte
+	prefix := buf[:0]
+	for i := 0; i < len(call); i++ {
+		if call[i] == ' ' {
+			continue
+		}
+		x := trieIndex(call[i])
+		if x < 0 || n.children[x] == nil {
+			return
+		}
+		n = n.children[x]
+		prefix = append(prefix, call[i])
+		if n.alias != nil {
+			fn(string(prefix), n.alias)
+		}
+	}
+}
+
+// Longest prefix of call in the trie.
+func (t *prefixTrie) longest(call string) (prefix string, ok bool) {
+
+	n := &t.root
+	var match *PrefixAlias
+	for i := 0; i < len(call); i++ {
+		if call[i] == ' ' {
+			continue
+		}
+		x := trieIndex(call[i])
+		if x < 0 || n.children[x] == nil {
+			break
+		}
+		n = n.children[x]
+		if n.alias != nil {
+			match = n.alias
+		}
+	}
+	if match == nil {
+		return "", false
+	}
+	return match.Prefix, true
+}
+
+// PrefixMatches returns every prefix entry matching the start of call, shortest first.
+func (db *Database) PrefixMatches(call string) []PrefixAlias {
+
+	var matches []PrefixAlias
+	db.trie.walk(call, func(prefix string, a *PrefixAlias) {
+		matches = append(matches, *a)
+	})
+	return matches
+}
+
+// PrefixMatches returns every prefix entry of the default database matching the start of call.
+func PrefixMatches(call string) []PrefixAlias {
+	return Default().PrefixMatches(call)
+}
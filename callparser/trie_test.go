@@ -0,0 +1,103 @@
+package callparser
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Calls used throughout callparser_test.go
+var testCalls = []string{
+	"HC2/DH1TW/P", "DH1T", "DH1TW/P", "DH1TW/MM", "FT5WQ/MM", "DH1TW/AM", "DH1TW/VP5", "VP5/DH1TW",
+	"VP5/DH1TW/P", "MM/DH1TW/P", "DH1TW/QRP", "DH1TW/QRPP", "MM/DH1TW/QRP", "MM/DH1TW/QRPP",
+	"MM/DH1TW/B", "MM/DH1TW/BCN", "EA1/DH1TW", "EA1/DH1TW/P", "DH1TW/EA1", "DH1TW/EA", "VP2E/AL1O/P",
+	"VP2E/DL2001IRTA/P", "DH1TW/EA8/QRP", "W0ERE/B", "ER/KL1A", "DL4SDW/HI3", "SV9/M1PAH/HH",
+	"8J3XVIII", "3DA0TM", "9A2HQ", "RU27TT", "UE90K", "DL2000ALMK", "HF450NS", "GB558VUL", "F/ON5OF",
+	"OX1A/OZ1ABC", "OX1A/OZ", "OZ5V", "OV9DV", "CQ59HQ", "RW3DQC/1/P", "DB0SUE-10", "DK0WYC-2",
+	"G0KTD/P", "GW8IZR-#", "DH", "DH1", "DH1TW/012", "01A/DH1TW", "01A/DH1TW/P", "01A/DH1TW/MM",
+	"QSL", "QRV", "T0NTO", "T0ALL", "H1GHMUF", "C1BBI", "PU1MHZ/QAP", "DU7/PA0", "DIPLOMA", "CQAS",
+	"IK2SAV/P1", "IKOFTA", "SP2/SP3", "CQ", "RADAR", "MUF/INFO", "RAVIDEO", "PIRATE", "XE1/H",
+	"Z125VZ", "ZD6DYA", "F5BUU1", "0", "0123456789", "CD43000", "GN", "ARABS", "2320900", "ITT9APL",
+	"MUF", "DH1TW/LH", "UR7GO/P/LH", "VK3/DH1TW/M", "DH1TW/EA3", "YB9IR/3", "UA9MAT/1", "W3LPL/5",
+	"UA9KRM/3", "UR900CC/4", "DK()DK", "DK/DK", "'!$&/()@", "", "DH1TW/BCN", "DH1TW/B",
+	"VP2M/DH1TW/BCN", "VP2M/DH1TW", "VP2M/DH1TW/AM", "VP2M/DH1TW/MM", "R7GA/MM", "DH1TW", "3D2CR",
+	"3D2CA", "K0ESQ", "K0ESQ/P", "K0ESQ-#", "K0ESQ/KH6", "K0ESQ/MM", "KL7DJ", "DP0GVN", "KH6ABC",
+	"W1AW/KH9", "K1ABC",
+}
+
+// The map based truncation loop the trie replaced, kept for comparison.
+func legacyIteratePrefix(db *Database, call string) (prefix string, ok bool) {
+
+	ok = true
+	prefix = call
+	for len(prefix) > 0 {
+		if _, found := db.prefixes[prefix]; found {
+			return
+		}
+		prefix = strings.Replace(prefix, " ", "", -1)
+		prefix = prefix[:len(prefix)-1]
+	}
+	ok = false
+	return
+}
+
+func TestTrieMatchesLegacy(t *testing.T) {
+
+	db := Default()
+	calls := append([]string{}, testCalls...)
+	for prefix := range db.prefixes {
+		calls = append(calls, prefix, prefix+"1ABC")
+	}
+	for _, call := range calls {
+		call = strings.ToUpper(call)
+		p1, ok1 := legacyIteratePrefix(db, call)
+		p2, ok2 := db.iteratePrefix(call)
+		if p1 != p2 || ok1 != ok2 {
+			t.Errorf("%s: legacy (%s, %v) trie (%s, %v)", call, p1, ok1, p2, ok2)
+		}
+	}
+}
+
+func TestPrefixMatches(t *testing.T) {
+
+	var got []string
+	for _, a := range PrefixMatches("KH6ABC") {
+		got = append(got, a.Prefix)
+	}
+	assertEqual(t, strings.Join(got, ","), "K,KH6")
+	assertEqual(t, len(PrefixMatches("0ABC")), 0)
+}
+
+func BenchmarkIteratePrefixLegacy(b *testing.B) {
+
+	db := Default()
+	for i := 0; i < b.N; i++ {
+		for _, call := range testCalls {
+			legacyIteratePrefix(db, call)
+		}
+	}
+}
+
+func BenchmarkIteratePrefixTrie(b *testing.B) {
+
+	db := Default()
+	for i := 0; i < b.N; i++ {
+		for _, call := range testCalls {
+			db.iteratePrefix(call)
+		}
+	}
+}
+
+func BenchmarkNewStation(b *testing.B) {
+
+	db := Default()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	for i := 0; i < b.N; i++ {
+		for _, call := range testCalls {
+			db.NewStation(call)
+		}
+	}
+}
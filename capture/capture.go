@@ -0,0 +1,109 @@
+// Package capture records raw RBN telnet lines with the time they were received and reads them back,
+// optionally paced as they originally arrived.
+package capture
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often buffered capture lines are flushed to the file.
+const flushInterval = time.Second
+
+// Writer - Records raw telnet lines with the time they were received to a gzipped capture
+// file, one line per entry as an RFC 3339 timestamp, a tab and the quoted line.  Reopening an
+// existing capture appends another gzip member, which readers treat as one stream.
+type Writer struct {
+	f       *os.File
+	gz      *gzip.Writer
+	mu      sync.Mutex
+	flushed time.Time
+}
+
+// NewWriter opens path for appending.
+func NewWriter(path string) (*Writer, error) {
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open capture file: %v", err)
+	}
+	return &Writer{f: f, gz: gzip.NewWriter(f), flushed: time.Now()}, nil
+}
+
+// Record appends a line received at the given time.
+func (c *Writer) Record(line string, at time.Time) error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.gz, "%s\t%s\n", at.UTC().Format(time.RFC3339Nano), strconv.Quote(line)); err != nil {
+		return err
+	}
+	// A crash loses at most the last interval of lines
+	if time.Since(c.flushed) >= flushInterval {
+		c.flushed = time.Now()
+		return c.gz.Flush()
+	}
+	return nil
+}
+
+// Close finishes the gzip stream and the file.
+func (c *Writer) Close() error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.gz.Close(); err != nil {
+		c.f.Close()
+		return err
+	}
+	return c.f.Close()
+}
+
+// Read calls fn with every line of a capture and the time it was received.  A speed of 1
+// paces the lines as they originally arrived, 10 ten times as fast and 0 as fast as possible.
+func Read(r io.Reader, speed float64, fn func(line string, at time.Time) error) error {
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("cannot read capture: %v", err)
+	}
+	defer gz.Close()
+
+	var first time.Time
+	start := time.Now()
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(fields) != 2 {
+			return fmt.Errorf("capture line %d: missing timestamp", n)
+		}
+		at, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("capture line %d: %v", n, err)
+		}
+		line, err := strconv.Unquote(fields[1])
+		if err != nil {
+			return fmt.Errorf("capture line %d: %v", n, err)
+		}
+		if first.IsZero() {
+			first = at
+		}
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(at.Sub(first)) / speed))
+			if wait := time.Until(due); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		if err := fn(line, at); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,114 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testCapture = []string{
+	"Please enter your call:",
+	"DX de DK9IP-#:    14025.1  K1ABC          CW    17 dB  25 WPM  CQ      1230Z\r\n",
+	"DX de W3LPL-#:     7025.0  DL1ABC\tCW    9 dB  22 WPM  CQ      1230Z\r\n",
+}
+
+func writeTestCapture(t *testing.T, path string, start time.Time, step time.Duration) {
+
+	c, err := NewWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range testCapture {
+		if err := c.Record(line, start.Add(time.Duration(i)*step)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCaptureRoundTrip(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "capture.gz")
+	start := time.Date(2021, 11, 27, 12, 30, 0, 123456789, time.UTC)
+	writeTestCapture(t, path, start, time.Second)
+	// Reopening appends
+	writeTestCapture(t, path, start.Add(time.Minute), time.Second)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	var times []time.Time
+	err = Read(bytes.NewReader(b), 0, func(line string, at time.Time) error {
+		lines = append(lines, line)
+		times = append(times, at)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2*len(testCapture) {
+		t.Fatalf("Expected %d lines, got %d", 2*len(testCapture), len(lines))
+	}
+	for i, line := range lines {
+		if line != testCapture[i%len(testCapture)] {
+			t.Errorf("Line %d: expected %q, got %q", i, testCapture[i%len(testCapture)], line)
+		}
+	}
+	if !times[0].Equal(start) || !times[4].Equal(start.Add(time.Minute+time.Second)) {
+		t.Errorf("Unexpected times %v", times)
+	}
+}
+
+func TestCaptureSpeed(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "capture.gz")
+	writeTestCapture(t, path, time.Now(), 500*time.Millisecond)
+	for _, tc := range []struct {
+		speed    float64
+		min, max time.Duration
+	}{
+		{0, 0, 200 * time.Millisecond},
+		{10, 100 * time.Millisecond, time.Second},
+	} {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		err = Read(f, tc.speed, func(string, time.Time) error { return nil })
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d < tc.min || d > tc.max {
+			t.Errorf("Speed %v took %v", tc.speed, d)
+		}
+	}
+}
+
+func TestCaptureStops(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "capture.gz")
+	writeTestCapture(t, path, time.Now(), time.Second)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stop := errors.New("stop")
+	n := 0
+	err = Read(f, 0, func(string, time.Time) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("Expected to stop after the first line, got %d lines and %v", n, err)
+	}
+}
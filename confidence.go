@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"gitlab.disney.com/guys-workspace/rbn-to-kinesis/callparser"
+)
+
+// Weights of the signals making up the confidence score.  A spot starts at baseConfidence.
+const (
+	baseConfidence   = 0.3
+	perSkimmerWeight = 0.1 // for each additional skimmer reporting the call
+	maxSkimmerWeight = 0.4
+	knownCallWeight  = 0.2 // call exists in the local DB or QRZ
+	scpWeight        = 0.2 // call is in the super check partial list
+	bustedPenalty    = 0.5 // a close call at the same frequency is reported by more skimmers
+)
+
+// Scorer estimates how likely a spotted call is genuine rather than a skimmer bust (K1ABC copied
+// as K1ABE).  It keeps the spots seen within Window and compares each new spot to the others
+// within FreqTolerance kHz.  Spots are indexed by frequency bucket, one tolerance wide, so only
+// the neighbouring buckets are compared.
+type Scorer struct {
+	Window        time.Duration
+	FreqTolerance float64
+	InSCP         func(call string) bool
+	mu            sync.Mutex
+	buckets       map[int64][]recentSpot
+	swept         time.Time
+}
+
+type recentSpot struct {
+	dx      string
+	skimmer string
+	freq    float64
+	at      time.Time
+}
+
+// NewScorer creates a scorer, SCP membership is ignored if inSCP is nil.
+func NewScorer(window time.Duration, freqTolerance float64, inSCP func(call string) bool) *Scorer {
+	return &Scorer{Window: window, FreqTolerance: freqTolerance, InSCP: inSCP,
+		buckets: make(map[int64][]recentSpot)}
+}
+
+// Score records a spot and returns the confidence (0 to 1) that dx is a real call.  known
+// indicates the call was found in the local DB or on QRZ.
+func (s *Scorer) Score(dx, skimmer string, freq float64, at time.Time, known bool) float64 {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := at.Add(-s.Window)
+	s.sweep(at, cutoff)
+	b := s.bucket(freq)
+	s.buckets[b] = append(s.buckets[b], recentSpot{dx: dx, skimmer: skimmer, freq: freq, at: at})
+
+	// Distinct skimmers per call near this frequency
+	skimmers := make(map[string]map[string]struct{})
+	for k := b - 1; k <= b+1; k++ {
+		spots := pruneSpots(s.buckets[k], cutoff)
+		if len(spots) == 0 {
+			delete(s.buckets, k)
+			continue
+		}
+		s.buckets[k] = spots
+		for _, r := range spots {
+			if math.Abs(r.freq-freq) > s.FreqTolerance {
+				continue
+			}
+			if skimmers[r.dx] == nil {
+				skimmers[r.dx] = make(map[string]struct{})
+			}
+			skimmers[r.dx][r.skimmer] = struct{}{}
+		}
+	}
+	count := len(skimmers[dx])
+
+	c := baseConfidence + math.Min(float64(count-1)*perSkimmerWeight, maxSkimmerWeight)
+	if known {
+		c += knownCallWeight
+	}
+	if s.InSCP != nil && s.InSCP(dx) {
+		c += scpWeight
+	}
+	for call, other := range skimmers {
+		if call != dx && len(other) > count && callparser.EditDistance(call, dx) == 1 {
+			c -= bustedPenalty
+			break
+		}
+	}
+	return math.Max(0, math.Min(1, c))
+}
+
+// Frequency bucket of freq, spots within the tolerance are in the same or a neighbouring bucket.
+func (s *Scorer) bucket(freq float64) int64 {
+
+	width := s.FreqTolerance
+	if width <= 0 {
+		width = 1
+	}
+	return int64(math.Floor(freq / width))
+}
+
+// Drop old spots from every bucket once per window, buckets that are not scored again would
+// otherwise keep them.
+func (s *Scorer) sweep(now, cutoff time.Time) {
+
+	if now.Sub(s.swept) < s.Window {
+		return
+	}
+	s.swept = now
+	for k, spots := range s.buckets {
+		if spots = pruneSpots(spots, cutoff); len(spots) == 0 {
+			delete(s.buckets, k)
+		} else {
+			s.buckets[k] = spots
+		}
+	}
+}
+
+// Drop spots before cutoff.  Spots are kept in arrival order, which is not always time order, so
+// every spot is checked.
+func pruneSpots(spots []recentSpot, cutoff time.Time) []recentSpot {
+
+	kept := spots[:0]
+	for _, r := range spots {
+		if !r.at.Before(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScorer(t *testing.T) {
+
+	t0 := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	scp := func(call string) bool { return call == "K1SCP" }
+	check := func(name string, got, want float64) {
+		t.Helper()
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s: expected %.2f, got %.2f", name, want, got)
+		}
+	}
+
+	s := NewScorer(2*time.Minute, 0.5, scp)
+	check("base", s.Score("K1ABC", "DK9IP", 14025.0, t0, false), baseConfidence)
+	check("second skimmer", s.Score("K1ABC", "W3LPL", 14025.2, t0, false), baseConfidence+perSkimmerWeight)
+	check("same skimmer again", s.Score("K1ABC", "W3LPL", 14025.1, t0, false), baseConfidence+perSkimmerWeight)
+	// W3LPL is within the tolerance in the next bucket, DK9IP is not
+	check("neighbouring bucket", s.Score("K1ABC", "VE3EID", 14025.6, t0, false), baseConfidence+perSkimmerWeight)
+	check("far frequency", s.Score("K1ABC", "KM3T", 14026.5, t0, false), baseConfidence)
+
+	// The skimmer weight is capped
+	s = NewScorer(2*time.Minute, 0.5, scp)
+	var c float64
+	for i := 0; i < 8; i++ {
+		c = s.Score("K1ABC", fmt.Sprintf("SK%d", i), 7025.0, t0, false)
+	}
+	check("cap", c, baseConfidence+maxSkimmerWeight)
+	check("known", s.Score("K1ABC", "SK9", 7025.0, t0, true), baseConfidence+maxSkimmerWeight+knownCallWeight)
+	// Known, on the SCP list and heard everywhere clamps to 1
+	for i := 0; i < 8; i++ {
+		c = s.Score("K1SCP", fmt.Sprintf("SK%d", i), 7030.0, t0, true)
+	}
+	check("clamp to 1", c, 1)
+
+	// A call one edit away from one more skimmers hear is likely busted, clamped to 0
+	s = NewScorer(2*time.Minute, 0.5, scp)
+	for _, sk := range []string{"DK9IP", "W3LPL", "VE3EID"} {
+		s.Score("K1ABC", sk, 14025.0, t0, true)
+	}
+	check("busted", s.Score("K1ABE", "KM3T", 14025.1, t0, false), 0)
+	check("busted elsewhere", s.Score("K1ABE", "KM3T", 14030.0, t0, false), baseConfidence)
+
+	// Spots older than the window no longer count
+	later := t0.Add(3 * time.Minute)
+	check("after the window", s.Score("K1ABE", "KM3T", 14025.1, later, false), baseConfidence)
+	if n := len(s.buckets); n != 1 {
+		t.Errorf("Expected old buckets swept, %d left", n)
+	}
+}
+
+func TestScorerOutOfOrder(t *testing.T) {
+
+	t0 := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewScorer(2*time.Minute, 0.5, nil)
+	s.Score("K1ABC", "DK9IP", 14025.0, t0.Add(3*time.Minute), false)
+	// A late spot from a lagging skimmer lands behind a newer one
+	s.Score("K1ABC", "W3LPL", 14025.0, t0, false)
+	got := s.Score("K1ABC", "VE3EID", 14025.0, t0.Add(3*time.Minute+30*time.Second), false)
+	if want := baseConfidence + perSkimmerWeight; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected the late spot pruned, got %.2f want %.2f", got, want)
+	}
+	if n := len(s.buckets[s.bucket(14025.0)]); n != 2 {
+		t.Errorf("Expected 2 spots left in the bucket, got %d", n)
+	}
+}
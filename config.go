@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const redacted = "*****"
+
+// Config holds the effective settings for the bridge.  Values are resolved in the following
+// order, later sources winning: built-in defaults, the YAML config file, environment variables
+// and finally command line flags.
+type Config struct {
+	Source      SourceConfig      `yaml:"source"`
+	Sinks       SinksConfig       `yaml:"sinks"`
+	Callbook    CallbookConfig    `yaml:"callbook"`
+	Country     CountryConfig     `yaml:"country"`
+	DB          DBConfig          `yaml:"db"`
+	BandPlan    BandPlanConfig    `yaml:"band_plan"`
+	Scoring     ScoringConfig     `yaml:"scoring"`
+	Aggregate   AggregateConfig   `yaml:"aggregate"`
+	Calibration CalibrationConfig `yaml:"calibration"`
+	Frequency   FrequencyConfig   `yaml:"frequency"`
+	Filters     FilterConfig      `yaml:"filters"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+}
+
+// SourceConfig - Where spots come from.
+type SourceConfig struct {
+	RBN RBNConfig `yaml:"rbn"`
+}
+
+// RBNConfig - RBN telnet endpoint and login.
+type RBNConfig struct {
+	Host       string `yaml:"host"`
+	Port       int    `yaml:"port"`
+	ClientCall string `yaml:"client_call"`
+	// Raw lines are recorded here for the replay command, empty disables
+	CaptureFile string `yaml:"capture_file"`
+	// Wait before reconnecting after the feed drops, doubling up to MaxReconnectDelay
+	ReconnectDelay    time.Duration `yaml:"reconnect_delay"`
+	MaxReconnectDelay time.Duration `yaml:"max_reconnect_delay"`
+}
+
+// SinksConfig - Where decorated spots are published, every configured sink receives them.
+type SinksConfig struct {
+	Kinesis KinesisConfig `yaml:"kinesis"`
+	Parquet ParquetConfig `yaml:"parquet"`
+	Avro    AvroConfig    `yaml:"avro"`
+	S3      S3Config      `yaml:"s3"`
+}
+
+// KinesisConfig - Kinesis stream settings.
+type KinesisConfig struct {
+	Stream string `yaml:"stream"`
+	Region string `yaml:"region"`
+	// Raw per-skimmer spots when aggregating, empty drops them
+	RawStream string `yaml:"raw_stream"`
+}
+
+// ParquetConfig - Directory Parquet files are written to, partitioned by date and band.  Files roll
+// every hour or when they reach MaxBytes.  Empty disables the sink.
+type ParquetConfig struct {
+	Dir      string `yaml:"dir"`
+	MaxBytes int64  `yaml:"max_bytes"`
+}
+
+// AvroConfig - Directory Avro Object Container Files are written to, partitioned by date.  Codec is
+// deflate, snappy or zstd.  Files roll every RollInterval or when they reach MaxBytes.  Empty Dir
+// disables the sink.
+type AvroConfig struct {
+	Dir          string        `yaml:"dir"`
+	Codec        string        `yaml:"codec"`
+	RollInterval time.Duration `yaml:"roll_interval"`
+	MaxBytes     int64         `yaml:"max_bytes"`
+}
+
+// S3Config - Bucket that hourly batches of spots are uploaded to as Format (avro, parquet or
+// ndjson) files, under Prefix and Hive style year=/month=/day=/hour= partitions.  Files are kept
+// in SpoolDir until uploaded.  Endpoint selects an S3 compatible store such as MinIO.  Empty Bucket
+// disables the sink.
+type S3Config struct {
+	Bucket   string `yaml:"bucket"`
+	Prefix   string `yaml:"prefix"`
+	Region   string `yaml:"region"`
+	Endpoint string `yaml:"endpoint"`
+	Format   string `yaml:"format"`
+	SpoolDir string `yaml:"spool_dir"`
+	MaxBytes int64  `yaml:"max_bytes"`
+	PartSize int64  `yaml:"part_size"`
+}
+
+// CallbookConfig - Callbook lookup settings.
+type CallbookConfig struct {
+	QRZ QRZConfig `yaml:"qrz"`
+	SCP SCPConfig `yaml:"scp"`
+}
+
+// QRZConfig - QRZ XML API credentials.
+type QRZConfig struct {
+	URL      string        `yaml:"url"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// SCPConfig - Super check partial list, reloaded when the file changes.  If set only calls on the
+// list are looked up on QRZ.
+type SCPConfig struct {
+	File           string        `yaml:"file"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// CountryConfig - Country file used to resolve prefixes, empty selects the embedded cty.dat.  Format
+// is one of dat, dxcc, wt_mod, wae or csv, guessed from the file name if empty; dxcc is cty.dat
+// without the WAE and CQ only entities.  The file is reloaded on SIGHUP or when it changes on disk,
+// and optionally refreshed from UpdateURL.  If ClubLogFile is set spots are resolved against the
+// Club Log cty.xml as of the spot time.
+type CountryConfig struct {
+	File           string        `yaml:"file"`
+	Format         string        `yaml:"format"`
+	ClubLogFile    string        `yaml:"clublog_file"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+	UpdateURL      string        `yaml:"update_url"`
+	UpdateInterval time.Duration `yaml:"update_interval"`
+}
+
+// DBConfig - Callsign database connection.  Driver is quanta (the default), mysql, postgres or
+// sqlite.  SQLite keeps the database in File, the others connect to HostPort with User and Password
+// and use the Schema database.  DSN, if set, is passed to the driver instead.  Schema migrations
+// run on startup unless SkipMigrations is set, i.e. when they are run with the migrate command.
+type DBConfig struct {
+	Driver   string `yaml:"driver"`
+	HostPort string `yaml:"host_port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Schema   string `yaml:"schema"`
+	File     string `yaml:"file"`
+	DSN      string `yaml:"dsn"`
+
+	SkipMigrations bool `yaml:"skip_migrations"`
+}
+
+// BandPlanConfig - YAML or JSON (.json) band plan used to name the band of a spot and segment map
+// used to classify it (cw, digital, phone, beacon ...), empty selects the built-in ones.  See
+// bandplan/default.yaml and bandplan/segments.yaml for the formats.
+type BandPlanConfig struct {
+	File         string `yaml:"file"`
+	SegmentsFile string `yaml:"segments_file"`
+}
+
+// ScoringConfig - Window and frequency tolerance (kHz) within which spots of the same call are
+// compared when scoring confidence.
+type ScoringConfig struct {
+	Window        time.Duration `yaml:"window"`
+	FreqTolerance float64       `yaml:"freq_tolerance_khz"`
+}
+
+// AggregateConfig - When enabled spots of the same DX and mode within FreqTolerance kHz are
+// collapsed into a single dx_heard event per Window.
+type AggregateConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Window        time.Duration `yaml:"window"`
+	FreqTolerance float64       `yaml:"freq_tolerance_khz"`
+}
+
+// CalibrationConfig - Skimmer frequency offsets are learned from spots of the same DX within
+// Window and FreqTolerance kHz and from the NCDXF beacons.  Estimates are saved to StateFile every
+// SaveInterval and on shutdown, and restored at startup.  OverrideFile (YAML skimmer: ppm) seeds
+// the skimmers without a restored estimate.
+type CalibrationConfig struct {
+	StateFile     string        `yaml:"state_file"`
+	OverrideFile  string        `yaml:"override_file"`
+	SaveInterval  time.Duration `yaml:"save_interval"`
+	Window        time.Duration `yaml:"window"`
+	FreqTolerance float64       `yaml:"freq_tolerance_khz"`
+}
+
+// FrequencyConfig - The reported frequency is published as is, freq_channel_hz is snapped to
+// ChannelStep (Hz) for grouping.  0 leaves it at the reported frequency.
+type FrequencyConfig struct {
+	ChannelStep int `yaml:"channel_step_hz"`
+}
+
+// FilterConfig - Spots not matching every non-empty criteria are dropped before publishing.
+type FilterConfig struct {
+	Bands    []string `yaml:"bands"`
+	Modes    []string `yaml:"modes"`
+	TxModes  []string `yaml:"tx_modes"`
+	Skimmers []string `yaml:"skimmers"`
+	// Call area (i.e. W6, VE3) and state/province of the skimmer
+	SkimmerRegions []string `yaml:"skimmer_regions"`
+	SkimmerStates  []string `yaml:"skimmer_states"`
+	MinDB          int      `yaml:"min_db"`
+	// Suppress likely busted spots, confidence ranges from 0 to 1
+	MinConfidence float64 `yaml:"min_confidence"`
+}
+
+// MetricsConfig - Address for the expvar metrics endpoint, empty disables it.
+type MetricsConfig struct {
+	Listen string `yaml:"listen"`
+}
+
+// DefaultConfig returns the built-in defaults.
+func DefaultConfig() *Config {
+
+	return &Config{
+		Source: SourceConfig{
+			RBN: RBNConfig{Host: "telnet.reversebeacon.net", Port: 7000, ClientCall: "N7ZG",
+				ReconnectDelay: 5 * time.Second, MaxReconnectDelay: 5 * time.Minute},
+		},
+		Sinks: SinksConfig{
+			Kinesis: KinesisConfig{Region: "us-east-1"},
+			Parquet: ParquetConfig{MaxBytes: 256 * 1024 * 1024},
+			Avro:    AvroConfig{Codec: "deflate", RollInterval: time.Hour, MaxBytes: 256 * 1024 * 1024},
+			S3: S3Config{Region: "us-east-1", Format: FormatAvro, SpoolDir: "spool", MaxBytes: 256 * 1024 * 1024,
+				PartSize: 16 * 1024 * 1024},
+		},
+		Callbook: CallbookConfig{
+			QRZ: QRZConfig{URL: "https://xmldata.qrz.com/xml/current/", Timeout: 2 * time.Second},
+			SCP: SCPConfig{ReloadInterval: time.Hour},
+		},
+		Country:   CountryConfig{ReloadInterval: time.Minute, UpdateInterval: 24 * time.Hour},
+		DB:        DBConfig{Driver: DriverQuanta, Schema: "quanta"},
+		Scoring:   ScoringConfig{Window: 2 * time.Minute, FreqTolerance: 0.5},
+		Aggregate: AggregateConfig{Window: time.Minute, FreqTolerance: 0.5},
+		Calibration: CalibrationConfig{SaveInterval: 5 * time.Minute, Window: time.Minute,
+			FreqTolerance: 0.3},
+	}
+}
+
+// LoadConfigFile overlays the contents of a YAML config file onto c.
+func (c *Config) LoadConfigFile(path string) error {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return fmt.Errorf("cannot parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate checks that required settings are present.
+func (c *Config) Validate() error {
+
+	if c.Sinks.Kinesis.Stream == "" && c.Sinks.Parquet.Dir == "" && c.Sinks.Avro.Dir == "" &&
+		c.Sinks.S3.Bucket == "" {
+		return fmt.Errorf("kinesis stream name, parquet directory, avro directory or s3 bucket is required")
+	}
+	return c.DB.Validate()
+}
+
+// Validate checks that QRZ can be logged in to.  Only needed if calls are looked up on QRZ.
+func (c *QRZConfig) Validate() error {
+
+	if c.Username == "" || c.Password == "" {
+		return fmt.Errorf("qrz username and password are required")
+	}
+	return nil
+}
+
+// Validate checks that the database can be connected to.
+func (c *DBConfig) Validate() error {
+
+	switch {
+	case c.DSN != "":
+	case c.Driver == DriverSQLite:
+		if c.File == "" {
+			return fmt.Errorf("db file is required for sqlite")
+		}
+	case c.HostPort == "":
+		return fmt.Errorf("db host:port is required")
+	case c.User == "":
+		return fmt.Errorf("db user is required")
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with secrets masked, suitable for logging.
+func (c *Config) Redacted() *Config {
+
+	r := *c
+	if r.Callbook.QRZ.Password != "" {
+		r.Callbook.QRZ.Password = redacted
+	}
+	if r.DB.Password != "" {
+		r.DB.Password = redacted
+	}
+	// May carry a password
+	if r.DB.DSN != "" {
+		r.DB.DSN = redacted
+	}
+	return &r
+}
+
+// String renders the redacted configuration as YAML.
+func (c *Config) String() string {
+
+	b, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const testConfigFile = `
+sinks:
+  kinesis:
+    stream: file-stream
+callbook:
+  qrz:
+    username: N7ZG
+    password: secret
+db:
+  host_port: db:4000
+  user: quanta
+aggregate:
+  enabled: true
+filters:
+  bands: [20m, 40m]
+  min_db: 10
+`
+
+// Parse args the way main does, with the config file given as --config.
+func parseConfig(t *testing.T, file string, args ...string) (*Config, error) {
+
+	app := kingpin.New("rbn-to-kinesis-test", "").DefaultEnvars()
+	app.Terminate(nil)
+	c := DefaultConfig()
+	flags := NewConfigFlags(app, c)
+	app.Command("run", "").Default()
+	if file != "" {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"--config", path}, args...)
+	}
+	_, err := flags.Parse(args)
+	return c, err
+}
+
+func TestConfigPrecedence(t *testing.T) {
+
+	// File over defaults
+	c, err := parseConfig(t, testConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Sinks.Kinesis.Stream != "file-stream" || !c.Aggregate.Enabled || c.Filters.MinDB != 10 ||
+		!reflect.DeepEqual(c.Filters.Bands, []string{"20m", "40m"}) {
+		t.Errorf("File settings not applied %+v", c)
+	}
+	if c.Source.RBN.Port != 7000 || c.Aggregate.Window != time.Minute {
+		t.Errorf("Defaults not kept %+v", c)
+	}
+
+	// Flags over the file, zero and false values included, lists replaced
+	c, err = parseConfig(t, testConfigFile, "--stream=flag-stream", "--filter-min-db=0", "--no-aggregate",
+		"--filter-band=10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Sinks.Kinesis.Stream != "flag-stream" || c.Aggregate.Enabled || c.Filters.MinDB != 0 ||
+		!reflect.DeepEqual(c.Filters.Bands, []string{"10m"}) {
+		t.Errorf("Flags not applied %+v", c)
+	}
+	if c.DB.HostPort != "db:4000" {
+		t.Errorf("Expected the file's db host:port, got %s", c.DB.HostPort)
+	}
+
+	// Environment over the file, flags over the environment
+	os.Setenv("RBN_TO_KINESIS_TEST_AGGREGATE", "false")
+	os.Setenv("RBN_TO_KINESIS_TEST_STREAM", "env-stream")
+	defer os.Unsetenv("RBN_TO_KINESIS_TEST_AGGREGATE")
+	defer os.Unsetenv("RBN_TO_KINESIS_TEST_STREAM")
+	if c, err = parseConfig(t, testConfigFile); err != nil {
+		t.Fatal(err)
+	}
+	if c.Sinks.Kinesis.Stream != "env-stream" || c.Aggregate.Enabled {
+		t.Errorf("Environment not applied %+v", c)
+	}
+	if c, err = parseConfig(t, testConfigFile, "--stream=flag-stream"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Sinks.Kinesis.Stream != "flag-stream" {
+		t.Errorf("Expected the flag over the environment, got %s", c.Sinks.Kinesis.Stream)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+
+	if _, err := parseConfig(t, "sinks:\n  kinesis:\n    streem: typo\n"); err == nil ||
+		!strings.Contains(err.Error(), "cannot parse config file") {
+		t.Errorf("Expected unknown keys to be rejected, got %v", err)
+	}
+	c := DefaultConfig()
+	if err := c.LoadConfigFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+
+	valid := func() *Config {
+		c := DefaultConfig()
+		c.Sinks.Kinesis.Stream = "spots"
+		c.Callbook.QRZ.Username, c.Callbook.QRZ.Password = "N7ZG", "secret"
+		c.DB.HostPort, c.DB.User = "db:4000", "quanta"
+		return c
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, change := range map[string]func(c *Config){
+		"no sink":        func(c *Config) { c.Sinks.Kinesis.Stream = "" },
+		"no db host":     func(c *Config) { c.DB.HostPort = "" },
+		"no db user":     func(c *Config) { c.DB.User = "" },
+		"sqlite no file": func(c *Config) { c.DB.Driver = DriverSQLite },
+	} {
+		c := valid()
+		change(c)
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	// Any one sink will do, a DSN replaces the connection settings
+	c := valid()
+	c.Sinks.Kinesis.Stream, c.Sinks.S3.Bucket = "", "spots"
+	c.DB = DBConfig{Driver: DriverPostgres, DSN: "postgres://db/ham"}
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// QRZ credentials are checked on their own, backfills can do without
+	c = valid()
+	if err := c.Callbook.QRZ.Validate(); err != nil {
+		t.Error(err)
+	}
+	c.Callbook.QRZ.Password = ""
+	if err := c.Callbook.QRZ.Validate(); err == nil {
+		t.Error("no qrz password: expected an error")
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("no qrz password: %v", err)
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+
+	c := DefaultConfig()
+	c.Callbook.QRZ.Username, c.Callbook.QRZ.Password = "N7ZG", "secret"
+	c.DB.Password, c.DB.DSN = "dbsecret", "postgres://u:dbsecret@db/ham"
+	s := c.String()
+	if strings.Contains(s, "secret") || !strings.Contains(s, "N7ZG") {
+		t.Errorf("Secrets not redacted:\n%s", s)
+	}
+	if c.Callbook.QRZ.Password != "secret" || c.DB.DSN == redacted {
+		t.Error("Redacted changed the configuration")
+	}
+	if r := DefaultConfig().Redacted(); r.Callbook.QRZ.Password != "" || r.DB.Password != "" {
+		t.Error("Unset secrets should stay empty")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hamba/avro"
+)
+
+// Output file formats.
+const (
+	FormatParquet = "parquet"
+	FormatAvro    = "avro"
+	FormatNDJSON  = "ndjson"
+)
+
+// recordWriter - Encodes records of one schema into a file.  Size is the number of bytes written
+// or buffered so far, Close finishes the encoding but leaves the underlying file open.
+type recordWriter interface {
+	Write(record map[string]interface{}) error
+	Size() int64
+	Close() error
+}
+
+func newRecordWriter(format, codec string, schema avro.Schema, w io.Writer) (recordWriter, error) {
+
+	switch format {
+	case FormatParquet:
+		return newParquetWriter(schema, w)
+	case FormatAvro:
+		return newOCFWriter(schema, w, codec)
+	case FormatNDJSON:
+		return newNDJSONWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown file format '%s'", format)
+}
+
+func formatExt(format string) string {
+
+	if format == FormatNDJSON {
+		return ".ndjson.gz"
+	}
+	return "." + format
+}
+
+// FileSink - Writes records to files under Dir, one file per record type and partition.  Partition
+// returns the directory of a record relative to Dir.  A file is finished when the spot time moves
+// into the next Roll interval or the file reaches MaxBytes, it's written under a dot name and
+// renamed when complete so readers never see a partial file.  Done, if set, is called with the
+// path of every finished file.  Codec applies to Avro files, deflate if empty.
+type FileSink struct {
+	Dir       string
+	Format    string
+	Codec     string
+	MaxBytes  int64
+	Roll      time.Duration
+	Partition func(name string, record map[string]interface{}, at time.Time) string
+	Done      func(path string)
+	mu        sync.Mutex
+	open      map[string]*outputFile
+	latest    time.Time
+	closed    bool
+}
+
+type outputFile struct {
+	path   string
+	period time.Time
+	file   *os.File
+	w      recordWriter
+	rows   int
+}
+
+// NewFileSink creates the output directory.
+func NewFileSink(dir, format string, maxBytes int64, roll time.Duration,
+	partition func(name string, record map[string]interface{}, at time.Time) string) (*FileSink, error) {
+
+	switch format {
+	case FormatParquet, FormatAvro, FormatNDJSON:
+	default:
+		return nil, fmt.Errorf("unknown file format '%s'", format)
+	}
+	if roll <= 0 {
+		roll = time.Hour
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileSink{Dir: dir, Format: format, MaxBytes: maxBytes, Roll: roll, Partition: partition,
+		open: make(map[string]*outputFile)}, nil
+}
+
+// Publish appends the record to the file of its partition.
+func (s *FileSink) Publish(schema avro.Schema, record map[string]interface{}, at time.Time) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("file sink %s is closed", s.Dir)
+	}
+	name := schemaName(schema)
+	at = at.UTC()
+	dir := filepath.Join(s.Dir, s.Partition(name, record, at))
+	key := name + "/" + dir
+	period := at.Truncate(s.Roll)
+
+	// Quiet partitions are finished once the period has moved on
+	if period.After(s.latest) {
+		s.latest = period
+		for k, f := range s.open {
+			if f.period.Before(period) {
+				delete(s.open, k)
+				if err := s.finish(f); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	f := s.open[key]
+	if f != nil && !f.period.Equal(period) {
+		delete(s.open, key)
+		if err := s.finish(f); err != nil {
+			return err
+		}
+		f = nil
+	}
+	if f == nil {
+		var err error
+		if f, err = s.create(dir, name, period, schema); err != nil {
+			return err
+		}
+		s.open[key] = f
+	}
+
+	if err := f.w.Write(record); err != nil {
+		return fmt.Errorf("cannot write %s: %v", f.path, err)
+	}
+	f.rows++
+	if s.MaxBytes > 0 && f.w.Size() >= s.MaxBytes {
+		delete(s.open, key)
+		return s.finish(f)
+	}
+	return nil
+}
+
+// Flush finishes every open file, the next record of a partition starts a new one.
+func (s *FileSink) Flush() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.finishAll()
+}
+
+// Close finishes every open file.
+func (s *FileSink) Close() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return s.finishAll()
+}
+
+func (s *FileSink) finishAll() error {
+
+	var first error
+	for key, f := range s.open {
+		delete(s.open, key)
+		if err := s.finish(f); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (s *FileSink) create(dir, name string, period time.Time, schema avro.Schema) (*outputFile, error) {
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s-%d%s", name, period.Format("20060102T150405"),
+		time.Now().UnixNano(), formatExt(s.Format)))
+	file, err := os.Create(filepath.Join(dir, "."+filepath.Base(path)))
+	if err != nil {
+		return nil, err
+	}
+	w, err := newRecordWriter(s.Format, s.Codec, schema, file)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &outputFile{path: path, period: period, file: file, w: w}, nil
+}
+
+func (s *FileSink) finish(f *outputFile) error {
+
+	if err := f.w.Close(); err != nil {
+		f.file.Close()
+		return fmt.Errorf("cannot finish %s: %v", f.path, err)
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.file.Name(), f.path); err != nil {
+		return err
+	}
+	log.Printf("Wrote %d rows to %s.", f.rows, f.path)
+	if s.Done != nil {
+		s.Done(f.path)
+	}
+	return nil
+}
+
+func schemaName(schema avro.Schema) string {
+
+	if rs, ok := schema.(*avro.RecordSchema); ok {
+		return rs.Name()
+	}
+	return "records"
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+)
+
+// Accept returns true if a decorated spot record passes all configured filters.
+func (f *FilterConfig) Accept(record map[string]interface{}) bool {
+
+	if !matchAny(f.Bands, record["band"]) {
+		return false
+	}
+	if !matchAny(f.Modes, record["mode"]) {
+		return false
+	}
+	if !matchAny(f.TxModes, record["tx_mode"]) {
+		return false
+	}
+	if !matchAny(f.Skimmers, record["callsign"]) {
+		return false
+	}
+	if !matchAny(f.SkimmerRegions, record["de_region"]) {
+		return false
+	}
+	if !matchAny(f.SkimmerStates, record["de_state"]) {
+		return false
+	}
+	if db, ok := record["db"].(int); ok && f.MinDB != 0 && db < f.MinDB {
+		return false
+	}
+	if c, ok := record["confidence"].(float64); ok && c < f.MinConfidence {
+		return false
+	}
+	return true
+}
+
+// An empty list matches everything.
+func matchAny(list []string, v interface{}) bool {
+
+	if len(list) == 0 {
+		return true
+	}
+	s, _ := v.(string)
+	for _, x := range list {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// ConfigFlags - Command line flags, and through DefaultEnvars environment variables, bound to the
+// fields of a Config.  Only flags that are given override the config file, so a zero value or
+// --no-<flag> can switch off a setting from the file.
+type ConfigFlags struct {
+	app    *kingpin.Application
+	config *Config
+	file   *kingpin.FlagClause
+	// Print the effective configuration and exit
+	Print bool
+}
+
+// NewConfigFlags adds the configuration flags to app, bound to c which should hold the defaults.
+func NewConfigFlags(app *kingpin.Application, c *Config) *ConfigFlags {
+
+	f := &ConfigFlags{app: app, config: c}
+	f.file = app.Flag("config", "YAML config file.")
+	f.file.String()
+	app.Flag("print-config", "Print the effective configuration (secrets redacted) and exit.").BoolVar(&f.Print)
+
+	app.Flag("stream", "Kinesis stream name.").StringVar(&c.Sinks.Kinesis.Stream)
+	app.Flag("region", "AWS region").StringVar(&c.Sinks.Kinesis.Region)
+	app.Flag("db-driver", "Callsign database (quanta, mysql, postgres, sqlite).").StringVar(&c.DB.Driver)
+	app.Flag("db-host-port", "Callsign database host:port").StringVar(&c.DB.HostPort)
+	app.Flag("db-user", "Callsign database user").StringVar(&c.DB.User)
+	app.Flag("db-password", "Callsign database password").StringVar(&c.DB.Password)
+	app.Flag("db-schema", "Callsign database name").StringVar(&c.DB.Schema)
+	app.Flag("db-file", "SQLite callsign database file.").StringVar(&c.DB.File)
+	app.Flag("db-dsn", "Data source name passed to the database driver as is.").StringVar(&c.DB.DSN)
+	app.Flag("db-skip-migrations", "Don't migrate the callsign database schema on startup.").BoolVar(&c.DB.SkipMigrations)
+	app.Flag("rbn-host", "Host for RBN endpoint.").StringVar(&c.Source.RBN.Host)
+	app.Flag("rbn-port", "Port number for service").IntVar(&c.Source.RBN.Port)
+	app.Flag("rbn-client-call", "RBN login call").StringVar(&c.Source.RBN.ClientCall)
+	app.Flag("capture-file", "Record raw telnet lines to this gzipped capture file for replay.").StringVar(&c.Source.RBN.CaptureFile)
+	app.Flag("qrz-url", "QRZ XML API endpoint.").StringVar(&c.Callbook.QRZ.URL)
+	app.Flag("qrz-user", "QRZ user").StringVar(&c.Callbook.QRZ.Username)
+	app.Flag("qrz-password", "QRZ password").StringVar(&c.Callbook.QRZ.Password)
+	app.Flag("scp-file", "Super check partial (MASTER.SCP) file.").StringVar(&c.Callbook.SCP.File)
+	app.Flag("qrz-timeout", "QRZ request timeout.").DurationVar(&c.Callbook.QRZ.Timeout)
+	app.Flag("cty-file", "Country file, defaults to the embedded cty.dat.").StringVar(&c.Country.File)
+	app.Flag("cty-format", "Country file format (dat, dxcc, wt_mod, wae, csv).").StringVar(&c.Country.Format)
+	app.Flag("clublog-file", "Club Log cty.xml for date aware DXCC resolution.").StringVar(&c.Country.ClubLogFile)
+	app.Flag("cty-update-url", "URL to fetch country file updates from.").StringVar(&c.Country.UpdateURL)
+	app.Flag("band-plan-file", "YAML or JSON band plan, defaults to the built-in plan.").StringVar(&c.BandPlan.File)
+	app.Flag("segments-file", "YAML or JSON sub-band segment map, defaults to the built-in map.").StringVar(&c.BandPlan.SegmentsFile)
+	app.Flag("channel-step", "Channel width in Hz that freq_channel_hz is snapped to, 0 disables.").IntVar(&c.Frequency.ChannelStep)
+	app.Flag("parquet-dir", "Directory to write Parquet files to.").StringVar(&c.Sinks.Parquet.Dir)
+	app.Flag("avro-dir", "Directory to write Avro Object Container Files to.").StringVar(&c.Sinks.Avro.Dir)
+	app.Flag("avro-codec", "Avro file compression codec (deflate, snappy, zstd).").StringVar(&c.Sinks.Avro.Codec)
+	app.Flag("avro-roll", "How often Avro files are rolled.").DurationVar(&c.Sinks.Avro.RollInterval)
+	app.Flag("s3-bucket", "S3 bucket to upload batches of spots to.").StringVar(&c.Sinks.S3.Bucket)
+	app.Flag("s3-prefix", "Key prefix within the S3 bucket.").StringVar(&c.Sinks.S3.Prefix)
+	app.Flag("s3-endpoint", "S3 compatible endpoint, i.e. MinIO.").StringVar(&c.Sinks.S3.Endpoint)
+	app.Flag("s3-format", "S3 file format (avro, parquet, ndjson).").StringVar(&c.Sinks.S3.Format)
+	app.Flag("s3-spool-dir", "Local directory for S3 uploads still pending.").StringVar(&c.Sinks.S3.SpoolDir)
+	app.Flag("raw-stream", "Kinesis stream for raw per-skimmer spots when aggregating.").StringVar(&c.Sinks.Kinesis.RawStream)
+	app.Flag("aggregate", "Publish one dx_heard event per DX and window instead of every spot.").BoolVar(&c.Aggregate.Enabled)
+	app.Flag("aggregate-window", "Time window spots are aggregated over.").DurationVar(&c.Aggregate.Window)
+	app.Flag("calibration-file", "File skimmer calibration estimates are saved to and restored from.").StringVar(&c.Calibration.StateFile)
+	app.Flag("calibration-overrides", "YAML file of skimmer calibration offsets (ppm) to seed the estimates.").StringVar(&c.Calibration.OverrideFile)
+	app.Flag("filter-band", "Only publish spots on this band (repeatable).").SetValue(&stringList{v: &c.Filters.Bands})
+	app.Flag("filter-mode", "Only publish spots in this mode (repeatable).").SetValue(&stringList{v: &c.Filters.Modes})
+	app.Flag("filter-tx-mode", "Only publish spots of this type (repeatable).").SetValue(&stringList{v: &c.Filters.TxModes})
+	app.Flag("filter-skimmer", "Only publish spots from this skimmer (repeatable).").SetValue(&stringList{v: &c.Filters.Skimmers})
+	app.Flag("filter-skimmer-region", "Only publish spots from skimmers in this call area, i.e. W6 (repeatable).").SetValue(&stringList{v: &c.Filters.SkimmerRegions})
+	app.Flag("filter-skimmer-state", "Only publish spots from skimmers in this state or province (repeatable).").SetValue(&stringList{v: &c.Filters.SkimmerStates})
+	app.Flag("filter-min-db", "Only publish spots at or above this SNR.").IntVar(&c.Filters.MinDB)
+	app.Flag("filter-min-confidence", "Suppress spots scored below this confidence (0-1).").Float64Var(&c.Filters.MinConfidence)
+	app.Flag("metrics-listen", "Address for the metrics endpoint.").StringVar(&c.Metrics.Listen)
+	return f
+}
+
+// Parse parses args and resolves the configuration: the defaults, then the config file, then
+// environment variables and flags.  Returns the selected command.
+func (f *ConfigFlags) Parse(args []string) (string, error) {
+
+	// Find the config file without setting any values, so the file goes in first
+	ctx, err := f.app.ParseContext(args)
+	if err != nil {
+		return "", err
+	}
+	path := ""
+	for _, flag := range f.app.Model().Flags {
+		if flag.Name == "config" && flag.Envar != "" {
+			path = os.Getenv(flag.Envar)
+		}
+	}
+	for _, el := range ctx.Elements {
+		if el.Clause == f.file && el.Value != nil {
+			path = *el.Value
+		}
+	}
+	if path != "" {
+		if err := f.config.LoadConfigFile(path); err != nil {
+			return "", err
+		}
+	}
+	return f.app.Parse(args)
+}
+
+// stringList - Repeatable flag whose values replace the list from the config file rather than add
+// to it.
+type stringList struct {
+	v   *[]string
+	set bool
+}
+
+func (s *stringList) Set(value string) error {
+
+	if !s.set {
+		*s.v = nil
+		s.set = true
+	}
+	*s.v = append(*s.v, value)
+	return nil
+}
+
+func (s *stringList) String() string {
+	return strings.Join(*s.v, ",")
+}
+
+func (s *stringList) IsCumulative() bool {
+	return true
+}
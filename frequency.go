@@ -0,0 +1,21 @@
+package main
+
+import (
+	"math"
+)
+
+// FreqHz converts a frequency in kHz to whole Hz.
+func FreqHz(khz float64) int64 {
+	return int64(math.Round(khz * 1000))
+}
+
+// Channelize snaps a frequency in Hz to the nearest multiple of step, i.e. 500 Hz buckets for CW.
+// A step of 0 or less returns the frequency unchanged.
+func Channelize(hz int64, step int) int64 {
+
+	if step <= 0 {
+		return hz
+	}
+	s := int64(step)
+	return (hz + s/2) / s * s
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestFreqHz(t *testing.T) {
+
+	for _, tc := range []struct {
+		khz  float64
+		want int64
+	}{
+		{14025.1, 14025100},
+		{7025.34, 7025340},
+		{1840.05, 1840050},
+		{3573.001, 3573001},
+		{10136.0, 10136000},
+		// Not representable exactly, rounds to the nearest Hz
+		{0.0005, 1},
+		{28074.9996, 28075000},
+		{0, 0},
+	} {
+		if got := FreqHz(tc.khz); got != tc.want {
+			t.Errorf("%v kHz: expected %d Hz, got %d", tc.khz, tc.want, got)
+		}
+	}
+}
+
+func TestChannelize(t *testing.T) {
+
+	for _, tc := range []struct {
+		hz   int64
+		step int
+		want int64
+	}{
+		{14025100, 500, 14025000},
+		{14025249, 500, 14025000},
+		// Half way rounds up
+		{14025250, 500, 14025500},
+		{14025500, 500, 14025500},
+		{14025749, 500, 14025500},
+		{7025340, 100, 7025300},
+		{7025350, 100, 7025400},
+		{7025340, 1, 7025340},
+		// No channelizing
+		{7025340, 0, 7025340},
+		{7025340, -500, 7025340},
+	} {
+		if got := Channelize(tc.hz, tc.step); got != tc.want {
+			t.Errorf("%d Hz step %d: expected %d, got %d", tc.hz, tc.step, tc.want, got)
+		}
+	}
+}
@@ -1,20 +1,21 @@
 module gitlab.disney.com/guys-workspace/rbn-to-kinesis
 
-go 1.14
+go 1.16
 
 require (
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
 	github.com/alecthomas/units v0.0.0-20210927113745-59d0afb8317a // indirect
-	github.com/araddon/qlbridge v0.0.2 // indirect
 	github.com/aws/aws-sdk-go v1.41.7
-	github.com/dchest/siphash v1.2.2 // indirect
-	github.com/disney/quanta v0.9.7
 	github.com/go-sql-driver/mysql v1.6.0
+	github.com/golang/snappy v0.0.4
 	github.com/hamba/avro v1.6.0
-	github.com/jteeuwen/go-bindata v3.0.7+incompatible // indirect
+	github.com/klauspost/compress v1.13.1
+	github.com/lib/pq v1.10.4
 	github.com/reiver/go-oi v1.0.0 // indirect
 	github.com/reiver/go-telnet v0.0.0-20180421082511-9ff0b2ab096e
+	github.com/xitongsys/parquet-go v1.6.2
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
+	gopkg.in/yaml.v2 v2.4.0
+	modernc.org/sqlite v1.14.8
 )
-
-replace github.com/disney/quanta => /home/ec2-user/quanta
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"sync"
+
+	"gitlab.disney.com/guys-workspace/rbn-to-kinesis/callparser"
+)
+
+// Counters published as JSON on the metrics endpoint.
+var (
+	spotsReceived    = expvar.NewInt("spots_received")
+	spotsPublished   = expvar.NewInt("spots_published")
+	spotsFiltered    = expvar.NewInt("spots_filtered")
+	spotsRejected    = expvar.NewInt("spots_rejected")
+	qrzLookups       = expvar.NewInt("qrz_lookups")
+	dxHeardPublished = expvar.NewInt("dx_heard_published")
+)
+
+func init() {
+	expvar.Publish("cty_version", expvar.Func(func() interface{} { return callparser.Version() }))
+}
+
+// Calibrator whose estimates are published, replaced when the pipeline is set up again.
+var calibration struct {
+	sync.Mutex
+	c    *Calibrator
+	once sync.Once
+}
+
+// PublishCalibration exports the skimmer frequency offset estimates.
+func PublishCalibration(c *Calibrator) {
+
+	calibration.Lock()
+	calibration.c = c
+	calibration.Unlock()
+	// expvar names can only be published once
+	calibration.once.Do(func() {
+		expvar.Publish("skimmer_calibration", expvar.Func(func() interface{} {
+			calibration.Lock()
+			defer calibration.Unlock()
+			return calibration.c.Estimates()
+		}))
+	})
+}
+
+// StartMetrics serves expvar metrics on the given address.  An empty address disables the endpoint.
+func StartMetrics(listen string) {
+
+	if listen == "" {
+		return
+	}
+	go func() {
+		log.Printf("Metrics listening on %s.", listen)
+		if err := http.ListenAndServe(listen, expvar.Handler()); err != nil {
+			log.Printf("Metrics endpoint error: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema changes for each database, migrations/<dialect>/NNNN_name.sql applied in version order.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration - One numbered schema change, the statements are separated by semicolons at the end of
+// a line.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Statements of the migration, without comments.
+func (m Migration) Statements() []string {
+
+	var stmts []string
+	var cur []string
+	for _, line := range strings.Split(m.SQL, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur = append(cur, line)
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(strings.Join(cur, "\n")), ";"))
+			cur = nil
+		}
+	}
+	if len(cur) > 0 {
+		stmts = append(stmts, strings.TrimSpace(strings.Join(cur, "\n")))
+	}
+	return stmts
+}
+
+// Migrations returns the embedded migrations of a dialect (mysql, postgres, sqlite) in version order.
+func Migrations(dir string) ([]Migration, error) {
+
+	entries, err := fs.ReadDir(migrationFiles, path.Join("migrations", dir))
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s: %v", dir, err)
+	}
+	var ms []Migration
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		sep := strings.Index(name, "_")
+		if sep < 0 {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.sql", name)
+		}
+		version, err := strconv.Atoi(name[:sep])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: bad version: %v", name, err)
+		}
+		b, err := migrationFiles.ReadFile(path.Join("migrations", dir, name))
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, Migration{Version: version, Name: strings.TrimSuffix(name[sep+1:], ".sql"), SQL: string(b)})
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	for i := 1; i < len(ms); i++ {
+		if ms[i].Version == ms[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", ms[i].Version)
+		}
+	}
+	return ms, nil
+}
+
+// MigrateCallsignDB brings the callsign database schema up to date and returns the migrations
+// applied, or with dryRun the ones that would be without changing anything.
+func MigrateCallsignDB(c DBConfig, dryRun bool) ([]Migration, error) {
+
+	db, d, err := openCallsignDB(c)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return migrate(db, d, dryRun)
+}
+
+// Apply the pending migrations of the dialect, each with its schema_migrations row.  Databases
+// that manage their own schema (Quanta) have none.
+func migrate(db *sql.DB, d dialect, dryRun bool) ([]Migration, error) {
+
+	if d.migrations == "" {
+		return nil, nil
+	}
+	all, err := Migrations(d.migrations)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		if _, err := db.Exec("create table if not exists schema_migrations (version integer not null primary key, " +
+			"name varchar(255) not null, applied_at timestamp not null)"); err != nil {
+			return nil, fmt.Errorf("cannot create schema_migrations: %v", err)
+		}
+	}
+	applied, err := appliedVersions(db, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, m := range all {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	if dryRun {
+		return pending, nil
+	}
+	for i, m := range pending {
+		if err := apply(db, d, m); err != nil {
+			return pending[:i], fmt.Errorf("migration %04d_%s failed: %v", m.Version, m.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// Versions recorded in schema_migrations, none if a dry run finds no table.
+func appliedVersions(db *sql.DB, dryRun bool) (map[int]bool, error) {
+
+	applied := make(map[int]bool)
+	rows, err := db.Query("select version from schema_migrations")
+	if err != nil {
+		if dryRun {
+			return applied, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// Run a migration in a transaction.  MySQL commits DDL as it goes, so a failure there can leave a
+// migration partly applied.
+func apply(db *sql.DB, d dialect, m Migration) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range m.Statements() {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("insert into schema_migrations (version, name, applied_at) values (%s, %s, %s)",
+		d.param(1), d.param(2), d.param(3)), m.Version, m.Name, time.Now().UTC()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
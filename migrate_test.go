@@ -0,0 +1,244 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+
+	var versions [][]int
+	for _, dir := range []string{DriverMySQL, DriverPostgres, DriverSQLite} {
+		ms, err := Migrations(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var vs []int
+		for _, m := range ms {
+			if len(m.Statements()) == 0 {
+				t.Errorf("%s %04d_%s has no statements", dir, m.Version, m.Name)
+			}
+			vs = append(vs, m.Version)
+		}
+		versions = append(versions, vs)
+	}
+	// Every database gets the same changes
+	if !reflect.DeepEqual(versions[0], versions[1]) || !reflect.DeepEqual(versions[0], versions[2]) {
+		t.Errorf("Migration versions differ between databases %v", versions)
+	}
+	if _, err := Migrations("oracle"); err == nil {
+		t.Error("Expected an error for a database without migrations")
+	}
+}
+
+func TestMigrationStatements(t *testing.T) {
+
+	m := Migration{SQL: "-- comment\ncreate table a (\n    x text -- inline\n);\n\ncreate index b on a (x);\nselect 1"}
+	want := []string{"create table a (\n    x text -- inline\n)", "create index b on a (x)", "select 1"}
+	if got := m.Statements(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestMigrateSQLite(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "callsign.db")
+	c := DBConfig{Driver: DriverSQLite, File: path}
+	all, _ := Migrations(DriverSQLite)
+
+	pending, err := MigrateCallsignDB(c, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != len(all) {
+		t.Errorf("Expected %d pending migrations, got %d", len(all), len(pending))
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tables := func() []string {
+		var names []string
+		rows, err := db.Query("select name from sqlite_master where type in ('table', 'index') and name not like 'sqlite_%' order by name")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			rows.Scan(&name)
+			names = append(names, name)
+		}
+		return names
+	}
+	if names := tables(); len(names) != 0 {
+		t.Errorf("Dry run changed the database %v", names)
+	}
+
+	// A callsign table from before migrations were tracked is adopted, its text values typed
+	cols, _ := sqlColumns(&QRZDatabase{})
+	for i, col := range cols {
+		cols[i] = `"` + col + `" text`
+	}
+	if _, err := db.Exec("create table callsign (" + strings.Join(cols, ", ") + ")"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`insert into callsign ("call", state, lat, license_exp_date, eqsl, lotw, dst, cq_zone, born)
+		values ('K1ABC', 'MA', ' 42.36', '0000-00-00', '1', '0', 'N', '5', '')`); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := MigrateCallsignDB(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(all) {
+		t.Errorf("Expected %d migrations applied, got %d", len(all), len(applied))
+	}
+	want := []string{"callsign", "callsign_alias", "callsign_alias_call", "callsign_aliases", "callsign_call",
+		"callsign_history", "callsign_history_call", "schema_migrations", "skimmer_stats"}
+	if names := tables(); !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected %v, got %v", want, names)
+	}
+	var n int
+	db.QueryRow("select count(*) from schema_migrations").Scan(&n)
+	if n != len(all) {
+		t.Errorf("Expected %d versions recorded, got %d", len(all), n)
+	}
+
+	var (
+		state               string
+		lat                 float64
+		expdate, born       sql.NullString
+		eqsl, lotw, dst, cq sql.NullInt64
+	)
+	if err := db.QueryRow(`select state, lat, license_exp_date, eqsl, lotw, dst, cq_zone, born from callsign
+		where "call" = 'K1ABC'`).Scan(&state, &lat, &expdate, &eqsl, &lotw, &dst, &cq, &born); err != nil {
+		t.Fatal(err)
+	}
+	if state != "MA" || lat != 42.36 || expdate.Valid || born.Valid || eqsl.Int64 != 1 || lotw.Int64 != 0 ||
+		!dst.Valid || dst.Int64 != 0 || cq.Int64 != 5 {
+		t.Errorf("Unexpected typed row %s %v %v %v %v %v %v %v", state, lat, expdate, eqsl, lotw, dst, cq, born)
+	}
+
+	if applied, err = MigrateCallsignDB(c, false); err != nil || len(applied) != 0 {
+		t.Errorf("Expected nothing to apply, got %v %v", applied, err)
+	}
+	if pending, err = MigrateCallsignDB(c, true); err != nil || len(pending) != 0 {
+		t.Errorf("Expected nothing pending, got %v %v", pending, err)
+	}
+}
+
+func TestMigrateQuanta(t *testing.T) {
+
+	// Quanta manages its own schema, nothing to apply and no connection needed to find out
+	db, d, err := openQuanta(DBConfig{HostPort: "localhost:4000", User: "quanta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if ms, err := migrate(db, d, false); err != nil || ms != nil {
+		t.Errorf("Expected no migrations, got %v %v", ms, err)
+	}
+}
+
+// Migrations against a MySQL or Postgres server, skipped unless RBN_TEST_MYSQL_DSN or
+// RBN_TEST_POSTGRES_DSN holds the DSN of a scratch database.  Its callsign tables are dropped.
+func TestMigrateServers(t *testing.T) {
+
+	// Index on a callsign table from before migrations were tracked
+	legacyIndex := map[string]string{
+		DriverMySQL:    "create index callsign_call on callsign (`call`(32))",
+		DriverPostgres: `create index callsign_call on callsign ("call")`,
+	}
+	for _, driver := range []string{DriverMySQL, DriverPostgres} {
+		t.Run(driver, func(t *testing.T) {
+			env := "RBN_TEST_" + strings.ToUpper(driver) + "_DSN"
+			dsn := os.Getenv(env)
+			if dsn == "" {
+				t.Skipf("%s is not set", env)
+			}
+			c := DBConfig{Driver: driver, DSN: dsn}
+			db, d, err := openCallsignDB(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { db.Close() })
+			drop := func() {
+				for _, table := range []string{"schema_migrations", "callsign_history", "callsign_alias",
+					"skimmer_stats", "callsign"} {
+					if _, err := db.Exec("drop table if exists " + table); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			drop()
+			t.Cleanup(drop)
+
+			// A text only callsign table with its call index is adopted
+			cols, _ := sqlColumns(&QRZDatabase{})
+			for i, col := range cols {
+				cols[i] = d.quote(col) + " text"
+			}
+			if _, err := db.Exec("create table callsign (" + strings.Join(cols, ", ") + ")"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec(legacyIndex[driver]); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec("insert into callsign (" + d.quote("call") + `, state, lat, license_exp_date, eqsl,
+				lotw, dst, cq_zone, born) values ('K1ABC', 'MA', ' 42.36', '0000-00-00', '1', '0', 'N', '5', '')`); err != nil {
+				t.Fatal(err)
+			}
+			all, _ := Migrations(driver)
+			applied, err := MigrateCallsignDB(c, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(applied) != len(all) {
+				t.Errorf("Expected %d migrations applied, got %d", len(all), len(applied))
+			}
+			var (
+				state           string
+				lat             float64
+				expdate, born   sql.NullString
+				eqsl, lotw, dst sql.NullBool
+				cq              sql.NullInt64
+			)
+			if err := db.QueryRow("select state, lat, license_exp_date, eqsl, lotw, dst, cq_zone, born from callsign "+
+				"where "+d.quote("call")+" = 'K1ABC'").Scan(&state, &lat, &expdate, &eqsl, &lotw, &dst, &cq, &born); err != nil {
+				t.Fatal(err)
+			}
+			if state != "MA" || lat != 42.36 || expdate.Valid || born.Valid || !eqsl.Bool || lotw.Bool ||
+				!dst.Valid || dst.Bool || cq.Int64 != 5 {
+				t.Errorf("Unexpected typed row %s %v %v %v %v %v %v %v", state, lat, expdate, eqsl, lotw, dst, cq, born)
+			}
+			if applied, err = MigrateCallsignDB(c, false); err != nil || len(applied) != 0 {
+				t.Errorf("Expected nothing to apply, got %v %v", applied, err)
+			}
+
+			// The store reads back what it writes, unknown values as null
+			store, err := OpenCallsignStore(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			qrz := &QRZDatabase{Call: "W6XYZ", Aliases: "KB6XYZ", State: "CA",
+				Lat: sql.NullFloat64{Float64: 37.77, Valid: true}, Lotw: sql.NullBool{Bool: true, Valid: true}}
+			if err := store.Insert(qrz); err != nil {
+				t.Fatal(err)
+			}
+			row, err := store.Get("KB6XYZ")
+			if err != nil || row == nil {
+				t.Fatalf("Expected the W6XYZ row, got %v %v", row, err)
+			}
+			if row["call"] != "W6XYZ" || row["state"] != "CA" || row["lon"] != nil || row["license_exp_date"] != nil {
+				t.Errorf("Unexpected row %v", row)
+			}
+		})
+	}
+}
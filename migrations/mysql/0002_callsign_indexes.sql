@@ -0,0 +1,15 @@
+-- MySQL has no create index if not exists, indexes already on an adopted table are skipped.  call
+-- may be text on those, so it is indexed on a prefix too.
+set @missing = (select count(*) = 0 from information_schema.statistics
+    where table_schema = database() and table_name = 'callsign' and index_name = 'callsign_call');
+set @stmt = if(@missing, 'create index callsign_call on callsign (`call`(32))', 'do 0');
+prepare create_index from @stmt;
+execute create_index;
+deallocate prepare create_index;
+-- aliases is text
+set @missing = (select count(*) = 0 from information_schema.statistics
+    where table_schema = database() and table_name = 'callsign' and index_name = 'callsign_aliases');
+set @stmt = if(@missing, 'create index callsign_aliases on callsign (aliases(64))', 'do 0');
+prepare create_index from @stmt;
+execute create_index;
+deallocate prepare create_index;
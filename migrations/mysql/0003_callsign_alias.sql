@@ -0,0 +1,6 @@
+-- Alternate calls (portable, previous, club) of a station, resolved to its home call.
+create table if not exists callsign_alias (
+    alias varchar(32) not null primary key,
+    `call` varchar(32) not null
+);
+create index callsign_alias_call on callsign_alias (`call`);
@@ -0,0 +1,9 @@
+-- Changes to callsign rows when a call is looked up again, one row per changed field.
+create table if not exists callsign_history (
+    `call` varchar(32) not null,
+    changed_at timestamp not null,
+    field varchar(32) not null,
+    old_value text,
+    new_value text
+);
+create index callsign_history_call on callsign_history (`call`, changed_at);
@@ -0,0 +1,8 @@
+-- Daily spot counts and frequency offset (ppm) estimates per skimmer.
+create table if not exists skimmer_stats (
+    skimmer varchar(32) not null,
+    day date not null,
+    spots bigint not null default 0,
+    ppm double,
+    primary key (skimmer, day)
+);
@@ -0,0 +1,34 @@
+-- Numbers, dates and QSL flags typed to match QRZDatabase.  Empty values and 0000-00-00 dates
+-- become null first, strict mode won't convert them.
+update callsign set
+    dxcc_id = nullif(trim(dxcc_id), ''),
+    lat = nullif(trim(lat), ''),
+    lon = nullif(trim(lon), ''),
+    license_issue_date = nullif(nullif(trim(license_issue_date), ''), '0000-00-00'),
+    license_exp_date = nullif(nullif(trim(license_exp_date), ''), '0000-00-00'),
+    u_views = nullif(trim(u_views), ''),
+    mod_date = nullif(nullif(trim(mod_date), ''), '0000-00-00 00:00:00'),
+    gmt_offset = nullif(trim(gmt_offset), ''),
+    dst = if(dst is null, null, upper(trim(dst)) = 'Y'),
+    eqsl = if(eqsl is null, null, trim(eqsl) = '1'),
+    mqsl = if(mqsl is null, null, trim(mqsl) = '1'),
+    lotw = if(lotw is null, null, trim(lotw) = '1'),
+    cq_zone = nullif(trim(cq_zone), ''),
+    itu_zone = nullif(trim(itu_zone), ''),
+    born = nullif(trim(born), '');
+alter table callsign
+    modify dxcc_id int,
+    modify lat double,
+    modify lon double,
+    modify license_issue_date date,
+    modify license_exp_date date,
+    modify u_views int,
+    modify mod_date datetime,
+    modify gmt_offset double,
+    modify dst boolean,
+    modify eqsl boolean,
+    modify mqsl boolean,
+    modify lotw boolean,
+    modify cq_zone int,
+    modify itu_zone int,
+    modify born int;
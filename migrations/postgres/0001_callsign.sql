@@ -0,0 +1,45 @@
+-- QRZ lookup results, one column per sql tag on QRZDatabase.  Adopts a table created before
+-- migrations were tracked.
+create table if not exists callsign (
+    "call" varchar(32),
+    aliases text,
+    dxcc_id text,
+    fname text,
+    lname text,
+    addr1 text,
+    addr2 text,
+    state text,
+    zip text,
+    mail_country text,
+    country_code text,
+    lat text,
+    lon text,
+    grid text,
+    county text,
+    fips text,
+    dxcc_country text,
+    license_issue_date text,
+    license_exp_date text,
+    prev_call text,
+    class text,
+    codes text,
+    qslmgr text,
+    email text,
+    u_views text,
+    mod_date text,
+    msa text,
+    area_code text,
+    time_zone text,
+    gmt_offset text,
+    dst text,
+    eqsl text,
+    mqsl text,
+    lotw text,
+    cq_zone text,
+    itu_zone text,
+    geoloc text,
+    attn text,
+    nickname text,
+    lname_fmt text,
+    born text
+);
@@ -0,0 +1,18 @@
+-- Numbers, dates and QSL flags typed to match QRZDatabase.  Empty values and 0000-00-00 dates
+-- become null.
+alter table callsign
+    alter column dxcc_id type integer using nullif(trim(dxcc_id), '')::integer,
+    alter column lat type double precision using nullif(trim(lat), '')::double precision,
+    alter column lon type double precision using nullif(trim(lon), '')::double precision,
+    alter column license_issue_date type date using nullif(nullif(trim(license_issue_date), ''), '0000-00-00')::date,
+    alter column license_exp_date type date using nullif(nullif(trim(license_exp_date), ''), '0000-00-00')::date,
+    alter column u_views type integer using nullif(trim(u_views), '')::integer,
+    alter column mod_date type timestamp using nullif(nullif(trim(mod_date), ''), '0000-00-00 00:00:00')::timestamp,
+    alter column gmt_offset type double precision using nullif(trim(gmt_offset), '')::double precision,
+    alter column dst type boolean using upper(trim(dst)) = 'Y',
+    alter column eqsl type boolean using trim(eqsl) = '1',
+    alter column mqsl type boolean using trim(mqsl) = '1',
+    alter column lotw type boolean using trim(lotw) = '1',
+    alter column cq_zone type integer using nullif(trim(cq_zone), '')::integer,
+    alter column itu_zone type integer using nullif(trim(itu_zone), '')::integer,
+    alter column born type integer using nullif(trim(born), '')::integer;
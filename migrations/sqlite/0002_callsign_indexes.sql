@@ -0,0 +1,2 @@
+create index if not exists callsign_call on callsign ("call");
+create index if not exists callsign_aliases on callsign (aliases);
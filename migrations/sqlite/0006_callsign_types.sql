@@ -0,0 +1,98 @@
+-- Numbers, dates and QSL flags typed to match QRZDatabase.  SQLite can't change a column's type,
+-- so the table is rebuilt.  Empty values and 0000-00-00 dates become null.
+create table callsign_new (
+    "call" text,
+    aliases text,
+    dxcc_id integer,
+    fname text,
+    lname text,
+    addr1 text,
+    addr2 text,
+    state text,
+    zip text,
+    mail_country text,
+    country_code text,
+    lat real,
+    lon real,
+    grid text,
+    county text,
+    fips text,
+    dxcc_country text,
+    license_issue_date date,
+    license_exp_date date,
+    prev_call text,
+    class text,
+    codes text,
+    qslmgr text,
+    email text,
+    u_views integer,
+    mod_date timestamp,
+    msa text,
+    area_code text,
+    time_zone text,
+    gmt_offset real,
+    dst boolean,
+    eqsl boolean,
+    mqsl boolean,
+    lotw boolean,
+    cq_zone integer,
+    itu_zone integer,
+    geoloc text,
+    attn text,
+    nickname text,
+    lname_fmt text,
+    born integer
+);
+insert into callsign_new (
+    "call", aliases, dxcc_id, fname, lname, addr1, addr2, state, zip, mail_country, country_code,
+    lat, lon, grid, county, fips, dxcc_country, license_issue_date, license_exp_date, prev_call,
+    class, codes, qslmgr, email, u_views, mod_date, msa, area_code, time_zone, gmt_offset, dst,
+    eqsl, mqsl, lotw, cq_zone, itu_zone, geoloc, attn, nickname, lname_fmt, born
+)
+select
+    "call",
+    aliases,
+    cast(nullif(trim(dxcc_id), '') as integer),
+    fname,
+    lname,
+    addr1,
+    addr2,
+    state,
+    zip,
+    mail_country,
+    country_code,
+    cast(nullif(trim(lat), '') as real),
+    cast(nullif(trim(lon), '') as real),
+    grid,
+    county,
+    fips,
+    dxcc_country,
+    nullif(nullif(trim(license_issue_date), ''), '0000-00-00'),
+    nullif(nullif(trim(license_exp_date), ''), '0000-00-00'),
+    prev_call,
+    class,
+    codes,
+    qslmgr,
+    email,
+    cast(nullif(trim(u_views), '') as integer),
+    nullif(nullif(trim(mod_date), ''), '0000-00-00 00:00:00'),
+    msa,
+    area_code,
+    time_zone,
+    cast(nullif(trim(gmt_offset), '') as real),
+    case when dst is null then null else upper(trim(dst)) = 'Y' end,
+    case when eqsl is null then null else trim(eqsl) = '1' end,
+    case when mqsl is null then null else trim(mqsl) = '1' end,
+    case when lotw is null then null else trim(lotw) = '1' end,
+    cast(nullif(trim(cq_zone), '') as integer),
+    cast(nullif(trim(itu_zone), '') as integer),
+    geoloc,
+    attn,
+    nickname,
+    lname_fmt,
+    cast(nullif(trim(born), '') as integer)
+from callsign;
+drop table callsign;
+alter table callsign_new rename to callsign;
+create index if not exists callsign_call on callsign ("call");
+create index if not exists callsign_aliases on callsign (aliases);
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+)
+
+// ndjsonWriter - Gzipped newline delimited JSON, one record per line.
+type ndjsonWriter struct {
+	cw *countingWriter
+	gz *gzip.Writer
+	je *json.Encoder
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+
+	cw := &countingWriter{w: w}
+	gz := gzip.NewWriter(cw)
+	return &ndjsonWriter{cw: cw, gz: gz, je: json.NewEncoder(gz)}
+}
+
+func (n *ndjsonWriter) Write(record map[string]interface{}) error {
+	return n.je.Encode(record)
+}
+
+// Size counts compressed bytes flushed so far, gzip holds back up to a window.
+func (n *ndjsonWriter) Size() int64 {
+	return n.cw.n
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.gz.Close()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/hamba/avro"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Serialized records buffered per Avro data block.
+const ocfBlockBytes = 64 * 1024
+
+// ocfWriter - Avro Object Container File with the schema embedded in the header, written in
+// blocks separated by a random sync marker and compressed with the null, deflate, snappy or
+// zstandard (zstd) codec.
+type ocfWriter struct {
+	schema  avro.Schema
+	w       io.Writer
+	codec   string
+	sync    [16]byte
+	block   bytes.Buffer
+	count   int64
+	written int64
+}
+
+func newOCFWriter(schema avro.Schema, w io.Writer, codec string) (*ocfWriter, error) {
+
+	codec, err := ocfCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+	o := &ocfWriter{schema: schema, w: w, codec: codec}
+	if _, err := rand.Read(o.sync[:]); err != nil {
+		return nil, err
+	}
+	var h bytes.Buffer
+	h.WriteString("Obj\x01")
+	meta := [][2]string{{"avro.schema", schema.String()}, {"avro.codec", codec}}
+	writeLong(&h, int64(len(meta)))
+	for _, kv := range meta {
+		writeBytes(&h, []byte(kv[0]))
+		writeBytes(&h, []byte(kv[1]))
+	}
+	writeLong(&h, 0)
+	h.Write(o.sync[:])
+	return o, o.write(h.Bytes())
+}
+
+// Name of a codec as written to the file header, deflate if empty.
+func ocfCodec(codec string) (string, error) {
+
+	switch codec {
+	case "":
+		return "deflate", nil
+	case "null", "deflate", "snappy", "zstandard":
+		return codec, nil
+	case "zstd":
+		return "zstandard", nil
+	}
+	return "", fmt.Errorf("unknown avro codec '%s'", codec)
+}
+
+func (o *ocfWriter) Write(record map[string]interface{}) error {
+
+	b, err := avro.Marshal(o.schema, record)
+	if err != nil {
+		return err
+	}
+	o.block.Write(b)
+	o.count++
+	if o.block.Len() >= ocfBlockBytes {
+		return o.flush()
+	}
+	return nil
+}
+
+func (o *ocfWriter) Size() int64 {
+	return o.written + int64(o.block.Len())
+}
+
+func (o *ocfWriter) Close() error {
+	return o.flush()
+}
+
+func (o *ocfWriter) flush() error {
+
+	if o.count == 0 {
+		return nil
+	}
+	data, err := o.compress(o.block.Bytes())
+	if err != nil {
+		return err
+	}
+	var h bytes.Buffer
+	writeLong(&h, o.count)
+	writeLong(&h, int64(len(data)))
+	if err := o.write(h.Bytes()); err != nil {
+		return err
+	}
+	if err := o.write(data); err != nil {
+		return err
+	}
+	if err := o.write(o.sync[:]); err != nil {
+		return err
+	}
+	o.block.Reset()
+	o.count = 0
+	return nil
+}
+
+func (o *ocfWriter) compress(b []byte) ([]byte, error) {
+
+	switch o.codec {
+	case "deflate":
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		fw.Write(b)
+		if err := fw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "snappy":
+		// Snappy blocks are followed by the big endian CRC32 of the uncompressed data
+		data := snappy.Encode(nil, b)
+		crc := make([]byte, 4)
+		binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(b))
+		return append(data, crc...), nil
+	case "zstandard":
+		zw, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer zw.Close()
+		return zw.EncodeAll(b, nil), nil
+	}
+	return b, nil
+}
+
+func (o *ocfWriter) write(b []byte) error {
+
+	n, err := o.w.Write(b)
+	o.written += int64(n)
+	return err
+}
+
+// Avro longs are zig-zag varints, the same encoding as binary.PutVarint.
+func writeLong(buf *bytes.Buffer, v int64) {
+
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+
+	writeLong(buf, int64(len(b)))
+	buf.Write(b)
+}
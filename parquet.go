@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hamba/avro"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Target size in bytes of a Parquet row group, rows are buffered until it is reached and then written out.
+const parquetRowGroupBytes = 16 * 1024 * 1024
+
+// NewParquetSink writes records as Parquet files under dir, partitioned as
+// date=YYYY-MM-DD/band=<band>/.  The columns are derived from the Avro schema of the record so the
+// files match what goes to Kinesis.  Files roll every hour of spot time or at maxBytes.
+func NewParquetSink(dir string, maxBytes int64) (*FileSink, error) {
+	return NewFileSink(dir, FormatParquet, maxBytes, time.Hour, datePartition)
+}
+
+// date=YYYY-MM-DD/band=<band>
+func datePartition(name string, record map[string]interface{}, at time.Time) string {
+
+	band, _ := record["band"].(string)
+	if band == "" {
+		band = "none"
+	}
+	return filepath.Join("date="+at.Format("2006-01-02"), "band="+band)
+}
+
+type parquetWriter struct {
+	pw *writer.JSONWriter
+}
+
+func newParquetWriter(schema avro.Schema, w io.Writer) (*parquetWriter, error) {
+
+	js, err := ParquetSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	pw, err := writer.NewJSONWriterFromWriter(js, w, 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.RowGroupSize = parquetRowGroupBytes
+	return &parquetWriter{pw: pw}, nil
+}
+
+func (p *parquetWriter) Write(record map[string]interface{}) error {
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return p.pw.Write(string(b))
+}
+
+func (p *parquetWriter) Size() int64 {
+	return p.pw.Offset + p.pw.ObjsSize
+}
+
+func (p *parquetWriter) Close() error {
+	return p.pw.WriteStop()
+}
+
+// ParquetSchema converts an Avro record schema into the JSON schema definition used by the
+// Parquet writer.  Strings are UTF8 byte arrays, int, long, double and boolean map to the matching
+// physical types and arrays of primitives to lists.
+func ParquetSchema(schema avro.Schema) (string, error) {
+
+	rs, ok := schema.(*avro.RecordSchema)
+	if !ok {
+		return "", fmt.Errorf("parquet needs a record schema, not %s", schema.Type())
+	}
+	type field struct {
+		Tag    string
+		Fields []field `json:",omitempty"`
+	}
+	root := field{Tag: fmt.Sprintf("name=%s, repetitiontype=REQUIRED", rs.Name())}
+	for _, f := range rs.Fields() {
+		if arr, ok := f.Type().(*avro.ArraySchema); ok {
+			elem, err := parquetType(arr.Items())
+			if err != nil {
+				return "", fmt.Errorf("field %s: %v", f.Name(), err)
+			}
+			root.Fields = append(root.Fields, field{
+				Tag:    fmt.Sprintf("name=%s, type=LIST, repetitiontype=REQUIRED", f.Name()),
+				Fields: []field{{Tag: "name=element, " + elem + ", repetitiontype=REQUIRED"}},
+			})
+			continue
+		}
+		t, err := parquetType(f.Type())
+		if err != nil {
+			return "", fmt.Errorf("field %s: %v", f.Name(), err)
+		}
+		root.Fields = append(root.Fields, field{Tag: fmt.Sprintf("name=%s, %s, repetitiontype=REQUIRED", f.Name(), t)})
+	}
+	b, err := json.Marshal(root)
+	return string(b), err
+}
+
+func parquetType(schema avro.Schema) (string, error) {
+
+	switch schema.Type() {
+	case avro.String:
+		return "type=BYTE_ARRAY, convertedtype=UTF8", nil
+	case avro.Int:
+		return "type=INT32", nil
+	case avro.Long:
+		return "type=INT64", nil
+	case avro.Double:
+		return "type=DOUBLE", nil
+	case avro.Float:
+		return "type=FLOAT", nil
+	case avro.Boolean:
+		return "type=BOOLEAN", nil
+	}
+	return "", fmt.Errorf("unsupported type %s", strings.ToLower(string(schema.Type())))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// A fully decorated spot.
+func testSpot(dx, band string, freq float64, at time.Time) map[string]interface{} {
+
+	return map[string]interface{}{
+		"band": band, "callsign": "DK9IP", "de_cont": "EU", "de_pfx": "DL", "dx": dx, "dx_cont": "NA",
+		"dx_pfx": "K", "de_state": "", "de_region": "", "dx_state": "MA", "dx_region": "W1", "freq": freq,
+		"freq_corrected": freq, "freq_hz": FreqHz(freq), "freq_channel_hz": FreqHz(freq), "mode": "CW",
+		"tx_mode": "CQ", "db": 17, "speed": 25, "confidence": 0.7, "in_scp": true, "out_of_band": false,
+		"segment": "cw", "is_ncdxf_beacon": false, "date": at.UnixNano() / int64(time.Millisecond),
+	}
+}
+
+func parquetFiles(t *testing.T, dir string) []string {
+
+	var files []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && filepath.Ext(path) == ".parquet" && !strings.HasPrefix(info.Name(), ".") {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, rel)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+func TestParquetSink(t *testing.T) {
+
+	schema := avro.MustParse(SpotSchema)
+	dir := t.TempDir()
+	sink, err := NewParquetSink(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2021, 10, 13, 12, 30, 0, 0, time.UTC)
+	spots := []struct {
+		dx, band string
+		freq     float64
+		at       time.Time
+	}{
+		{"K1ABC", "20m", 14025.1, at},
+		{"K1ABD", "20m", 14026.3, at.Add(time.Minute)},
+		{"K1ABC", "40m", 7025.0, at},
+		{"K1ABC", "20m", 14025.1, at.Add(time.Hour)},
+	}
+	for _, s := range spots {
+		if err := sink.Publish(schema, testSpot(s.dx, s.band, s.freq, s.at), s.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The 12:00 files are finished when 13:00 spots arrive
+	if files := parquetFiles(t, dir); len(files) != 2 {
+		t.Errorf("Expected 2 finished files, got %v", files)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := parquetFiles(t, dir)
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 files, got %v", files)
+	}
+	if d := filepath.Dir(files[0]); d != filepath.Join("date=2021-10-13", "band=20m") {
+		t.Errorf("Unexpected partition %s", d)
+	}
+
+	pf, err := local.NewLocalFileReader(filepath.Join(dir, files[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Close()
+	pr, err := reader.NewParquetReader(pf, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	if n := pr.GetNumRows(); n != 2 {
+		t.Errorf("Expected 2 rows, got %d", n)
+	}
+	types := make(map[string]parquet.Type)
+	// The reader renames columns to Go field names, the names in the file are in the handler
+	for i, e := range pr.Footer.Schema[1:] {
+		types[pr.SchemaHandler.Infos[i+1].ExName] = e.GetType()
+	}
+	want := map[string]parquet.Type{
+		"callsign": parquet.Type_BYTE_ARRAY,
+		"date":     parquet.Type_INT64,
+		"db":       parquet.Type_INT32,
+		"freq":     parquet.Type_DOUBLE,
+		"freq_hz":  parquet.Type_INT64,
+		"in_scp":   parquet.Type_BOOLEAN,
+	}
+	for name, typ := range want {
+		if types[name] != typ {
+			t.Errorf("Column %s is %v want %v", name, types[name], typ)
+		}
+	}
+}
+
+func TestParquetSchema(t *testing.T) {
+
+	if _, err := ParquetSchema(avro.MustParse(DxHeardSchema)); err != nil {
+		t.Errorf("dx_heard schema: %v", err)
+	}
+	if _, err := ParquetSchema(avro.MustParse(`"string"`)); err == nil {
+		t.Errorf("Non record schema should fail")
+	}
+}
+
+func TestParquetDxHeard(t *testing.T) {
+
+	dir := t.TempDir()
+	sink, err := NewParquetSink(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2021, 10, 13, 12, 30, 0, 0, time.UTC)
+	agg := NewAggregator(time.Minute, 0.5)
+	agg.Add(testSpot("K1ABC", "20m", 14025.1, at), at)
+	for _, e := range agg.Flush(at.Add(time.Minute)) {
+		if err := sink.Publish(avro.MustParse(DxHeardSchema), e, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files := parquetFiles(t, dir); len(files) != 1 {
+		t.Errorf("Expected 1 file, got %v", files)
+	}
+}
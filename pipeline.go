@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.disney.com/guys-workspace/rbn-to-kinesis/bandplan"
+)
+
+// SpotSchema - Avro schema of a decorated spot.
+const SpotSchema = `{
+	    "type": "record",
+	    "name": "spot_events",
+	    "namespace": "quanta",
+	    "fields" : [
+	        {"name": "band", "type": "string"},
+	        {"name": "callsign", "type": "string"},
+	        {"name": "de_cont", "type": "string"},
+	        {"name": "de_pfx", "type": "string"},
+	        {"name": "dx", "type": "string"},
+	        {"name": "dx_cont", "type": "string"},
+	        {"name": "dx_pfx", "type": "string"},
+	        {"name": "de_state", "type": "string"},
+	        {"name": "de_region", "type": "string"},
+	        {"name": "dx_state", "type": "string"},
+	        {"name": "dx_region", "type": "string"},
+	        {"name": "freq", "type": "double"},
+	        {"name": "freq_corrected", "type": "double"},
+	        {"name": "freq_hz", "type": "long"},
+	        {"name": "freq_channel_hz", "type": "long"},
+	        {"name": "mode", "type": "string"},
+	        {"name": "tx_mode", "type": "string"},
+	        {"name": "db", "type": "int"},
+	        {"name": "speed", "type": "int"},
+	        {"name": "confidence", "type": "double"},
+	        {"name": "in_scp", "type": "boolean"},
+	        {"name": "out_of_band", "type": "boolean"},
+	        {"name": "segment", "type": "string"},
+	        {"name": "is_ncdxf_beacon", "type": "boolean"},
+	        {"name": "date", "type": "long"}
+	    ]
+	}`
+
+var splitex = regexp.MustCompile("[[:space:]]+")
+
+// ParseSpot parses a line of the RBN telnet feed received at now into a spot record.  Lines that
+// aren't spots (banners, prompts) return nil without an error.
+func ParseSpot(str string, now time.Time) (map[string]interface{}, error) {
+
+	s := splitex.Split(str, 13)
+	if len(s) < 10 || s[2] == "de" {
+		return nil, nil
+	}
+	record := make(map[string]interface{})
+	record["callsign"] = skimmerCall(s[2])
+	freq, err := strconv.ParseFloat(s[3], 64)
+	if err != nil {
+		return nil, fmt.Errorf("FREQ ERR %v", s[3])
+	}
+	record["freq"] = freq
+	record["dx"] = s[4]
+	record["mode"] = s[5]
+	if strength, err2 := strconv.ParseInt(s[6], 10, 64); err2 != nil {
+		return nil, fmt.Errorf("STRENGTH ERR %v", s[6])
+	} else {
+		record["db"] = int(strength)
+	}
+	if speed, err3 := strconv.ParseInt(s[8], 10, 32); err3 != nil {
+		return nil, fmt.Errorf("SPEED ERR %v", s[8])
+	} else {
+		record["speed"] = int(speed)
+	}
+	record["tx_mode"] = s[10]
+	timeStr := s[11]
+	if timeStr == "B" {
+		timeStr = strings.TrimSpace(s[12])
+	}
+	if !strings.HasSuffix(timeStr, "Z") || len(timeStr) != 5 {
+		return nil, fmt.Errorf("TIME ERR [%v] - %v", s[11], str)
+	}
+	hri, _ := strconv.ParseInt(timeStr[0:2], 10, 64)
+	mni, _ := strconv.ParseInt(timeStr[2:4], 10, 64)
+	x := now.UTC()
+	y := time.Date(x.Year(), x.Month(), x.Day(), int(hri), int(mni), 0, 0, time.UTC)
+	// Adjust for clock skew
+	if x.Hour() == 0 && hri == 23 {
+		y = y.AddDate(0, 0, -1)
+	}
+	if x.Hour() == 23 && hri == 0 {
+		y = y.AddDate(0, 0, 1)
+	}
+	record["date"] = y.Unix() * 1000
+	return record, nil
+}
+
+// Skimmer call without the -# suffix and SSID, i.e. DK9IP-#: is DK9IP.
+func skimmerCall(s string) string {
+
+	c := strings.Split(s, "-")
+	return strings.TrimRight(c[0], "0123456789")
+}
+
+// Process decorates a parsed spot, received at the given time, and publishes it if it passes the
+// filters.  An error means the pipeline can't continue (database or sink failure), spots that
+// can't be decorated are counted and dropped.
+func (m *Main) Process(record map[string]interface{}, received time.Time) error {
+
+	call := record["callsign"].(string)
+	dx := record["dx"].(string)
+	freq := record["freq"].(float64)
+	spotTime := time.Unix(0, record["date"].(int64)*int64(time.Millisecond)).UTC()
+
+	// Keep the frequency as reported, channelized copies go in their own fields
+	record["freq_hz"] = FreqHz(freq)
+	record["freq_channel_hz"] = Channelize(record["freq_hz"].(int64), m.Frequency.ChannelStep)
+	// The live spot time is only to the minute, the beacon time slot needs the time it was received
+	record["is_ncdxf_beacon"] = bandplan.IsNCDXFBeacon(dx, freq, received)
+	m.Calibrator.Observe(call, dx, freq, received, record["is_ncdxf_beacon"].(bool))
+	record["freq_corrected"] = m.Calibrator.Correct(call, freq)
+
+	deRow, err := m.getAndInsertRowForCall(call, true)
+	if err != nil {
+		return err
+	}
+
+	// Without an SCP every unknown dx call is fetched from QRZ, with one only calls on the list are
+	// worth a query.  Calls already in the local DB are always used.
+	record["in_scp"] = m.inSCP(dx)
+	dxRow, err := m.getAndInsertRowForCall(dx, m.SCP == nil || record["in_scp"].(bool))
+	if err != nil {
+		return err
+	}
+	// State on file for the home call, Decorate checks it against the call area
+	record["de_state"] = rowState(deRow)
+	record["dx_state"] = rowState(dxRow)
+	record["confidence"] = m.Scorer.Score(dx, call, freq, spotTime, dxRow != nil)
+
+	if err := m.Decorate(record); err != nil {
+		log.Printf("%v", err)
+		spotsRejected.Add(1)
+		return nil
+	}
+	if !m.Filters.Accept(record) {
+		spotsFiltered.Add(1)
+		return nil
+	}
+	return m.publish(record, spotTime, received)
+}
+
+func (m *Main) publish(record map[string]interface{}, spotTime, received time.Time) error {
+
+	if m.Aggregator == nil {
+		if err := m.Sink.Publish(m.spotSchema, record, spotTime); err != nil {
+			return err
+		}
+		spotsPublished.Add(1)
+		return nil
+	}
+	// Raw per-skimmer spots go to their own sink, if any, dx_heard events to the main one
+	if m.RawSink != nil {
+		if err := m.RawSink.Publish(m.spotSchema, record, spotTime); err != nil {
+			return err
+		}
+		spotsPublished.Add(1)
+	}
+	m.Aggregator.Add(record, received)
+	return m.flush(received)
+}
+
+// Publish the dx_heard events whose window has closed as of now.
+func (m *Main) flush(now time.Time) error {
+
+	// The live flush ticker publishes alongside the feed
+	m.flushMu.Lock()
+	defer m.flushMu.Unlock()
+	for _, event := range m.Aggregator.Flush(now) {
+		if err := m.Sink.Publish(m.heardSchema, event, now); err != nil {
+			return err
+		}
+		dxHeardPublished.Add(1)
+	}
+	return nil
+}
+
+// Publish the dx_heard events of closed windows every interval until ctx is done, so an idle feed
+// doesn't hold them back.  On a sink failure cancel stops the feed and the error is returned.
+func (m *Main) flushEvery(ctx context.Context, cancel context.CancelFunc, interval time.Duration) error {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			if err := m.flush(now.UTC()); err != nil {
+				cancel()
+				return err
+			}
+		}
+	}
+}
+
+// How often the live feed flushes dx_heard events, they are published at most this late.
+func (m *Main) flushInterval() time.Duration {
+
+	if w := m.Aggregate.Window; w > 0 && w < time.Second {
+		return w
+	}
+	return time.Second
+}
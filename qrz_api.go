@@ -1,46 +1,65 @@
 package main
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
 
-var (
+// errQRZLogin - Wrapped by lookup errors when QRZ can't be logged in to.
+var errQRZLogin = errors.New("qrz login failed")
+
+// QRZClient - Session with the QRZ XML API.  Calls QRZ doesn't know are remembered and not looked
+// up again.
+type QRZClient struct {
+	URL           string
+	Username      string
+	Password      string
+	Client        *http.Client
 	sessionKey    string
 	notFoundCache map[string]struct{}
-)
+}
 
-const (
-	httppostUrl = "https://xmldata.qrz.com/xml/current/"
-	username    = "N7ZG"
-	password    = "tempest"
-)
+// NewQRZClient creates a client for the QRZ endpoint and credentials in c.
+func NewQRZClient(c QRZConfig) *QRZClient {
 
-func GetCallFromQRZ(call string) (*QRZDatabase, error) {
+	timeout := time.Second * 2
+	if c.Timeout > 0 {
+		timeout = c.Timeout
+	}
+	return &QRZClient{URL: c.URL, Username: c.Username, Password: c.Password,
+		Client: &http.Client{Timeout: timeout}, notFoundCache: make(map[string]struct{})}
+}
+
+// GetCall looks call up on QRZ, logging in first if there is no session.  A failed login returns an
+// error wrapping errQRZLogin.
+func (q *QRZClient) GetCall(call string) (*QRZDatabase, error) {
 
 	var qrz *QRZDatabase
 	var err error
-	if notFoundCache == nil {
-		notFoundCache = make(map[string]struct{})
-	}
 
-	if sessionKey == "" {
-		login()
+	if q.sessionKey == "" {
+		if err := q.login(); err != nil {
+			return nil, err
+		}
 	}
 
-	if _, found := notFoundCache[call]; found {
+	if _, found := q.notFoundCache[call]; found {
 		return nil, fmt.Errorf("Ignoring, %s in not found cache.", call)
 	}
 
-	qrz, err = tryCall(call)
+	qrz, err = q.tryCall(call)
 	if err != nil {
 		if strings.HasPrefix(err.Error(), "Not found") {
-			notFoundCache[call] = struct{}{}
+			q.notFoundCache[call] = struct{}{}
 			return nil, err
 		}
 		if err.Error() != "Session Timeout" {
@@ -49,8 +68,10 @@ func GetCallFromQRZ(call string) (*QRZDatabase, error) {
 		log.Printf("Session timed out, logging in again.")
 	}
 	if qrz == nil || qrz.Key == "" {
-		login()
-		qrz, err = tryCall(call)
+		if err := q.login(); err != nil {
+			return nil, err
+		}
+		qrz, err = q.tryCall(call)
 		if err == nil {
 			return qrz, nil
 		}
@@ -61,48 +82,48 @@ func GetCallFromQRZ(call string) (*QRZDatabase, error) {
 }
 
 // lookup call via QRZ API
-func tryCall(call string) (*QRZDatabase, error) {
+func (q *QRZClient) tryCall(call string) (*QRZDatabase, error) {
 
 	params := make(map[string]string)
-	params["s"] = sessionKey
+	params["s"] = q.sessionKey
 	params["callsign"] = call
-	return QRZAPI(params)
+	qrzLookups.Add(1)
+	return q.QRZAPI(params)
 }
 
-func login() {
+func (q *QRZClient) login() error {
 
 	// Log into QRZ
 	params := make(map[string]string)
-	params["username"] = username
-	params["password"] = password
-	qrz, err := QRZAPI(params)
+	params["username"] = q.Username
+	params["password"] = q.Password
+	qrz, err := q.QRZAPI(params)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("%w: %v", errQRZLogin, err)
 	}
 	if qrz.Key == "" {
-		log.Fatal(fmt.Errorf("NO KEY QRZ ERR: %v", qrz.Error))
+		return fmt.Errorf("%w: no session key: %v", errQRZLogin, qrz.Error)
 	}
-	sessionKey = qrz.Key
-	return
+	q.sessionKey = qrz.Key
+	return nil
 }
 
-func QRZAPI(params map[string]string) (*QRZDatabase, error) {
+func (q *QRZClient) QRZAPI(params map[string]string) (*QRZDatabase, error) {
 
-	request, err := http.NewRequest("GET", httppostUrl, nil)
+	request, err := http.NewRequest("GET", q.URL, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	q := request.URL.Query()
+	qs := request.URL.Query()
 	for k, v := range params {
-		q.Set(k, v)
+		qs.Set(k, v)
 	}
-	request.URL.RawQuery = q.Encode()
+	request.URL.RawQuery = qs.Encode()
 	//fmt.Println(request.URL.String())
 
-	client := &http.Client{Timeout: time.Second * 2}
 	var response *http.Response
-	response, err = client.Do(request)
+	response, err = q.Client.Do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -124,16 +145,13 @@ func QRZAPI(params map[string]string) (*QRZDatabase, error) {
 	if qrz != nil && qrz.Error != "" {
 		return nil, fmt.Errorf(qrz.Error)
 	}
-	if qrz != nil && qrz.Expdate == "0000-00-00" {
-		qrz.Expdate = ""
-	}
-	if qrz != nil && qrz.Efdate == "0000-00-00" {
-		qrz.Efdate = ""
-	}
 	return qrz, nil
 
 }
 
+// QRZDatabase - QRZ XML API response, the session and, for a lookup, the callsign record.  Numbers,
+// dates and flags are typed and null when QRZ has no value, see UnmarshalXML.  Fields with sql tags
+// are callsign table columns.
 type QRZDatabase struct {
 	// Session
 	Key     string `xml:"Session>Key,omitempty"`
@@ -145,54 +163,156 @@ type QRZDatabase struct {
 	Error   string `xml:"Session>Error,omitempty"`
 
 	//Callsign
-	Call    string `xml:"Callsign>call,omitempty" sql:"call"`
-	Aliases string `xml:"Callsign>aliases,omitempty" sql:"aliases"`
-	Dxcc    string `xml:"Callsign>dxcc,omitempty" sql:"dxcc_id"`
-	Fname   string `xml:"Callsign>fname,omitempty" sql:"fname"`
-	Name    string `xml:"Callsign>name,omitempty" sql:"lname"`
-	Addr1   string `xml:"Callsign>addr1,omitempty" sql:"addr1"`
-	Addr2   string `xml:"Callsign>addr2,omitempty" sql:"addr2"`
-	State   string `xml:"Callsign>state,omitempty" sql:"state"`
-	Zip     string `xml:"Callsign>zip,omitempty" sql:"zip"`
-	Country string `xml:"Callsign>country,omitempty" sql:"mail_country"`
-	Ccode   string `xml:"Callsign>ccode,omitempty" sql:"country_code"`
-	//Lat       float64 `xml:"Callsign>lat,omitempty" sql:"lat"`
-	//Lon       float64 `xml:"Callsign>lon,omitempty" sql:"lon"`
-	Lat     string `xml:"Callsign>lat,omitempty" sql:"lat"`
-	Lon     string `xml:"Callsign>lon,omitempty" sql:"lon"`
-	Grid    string `xml:"Callsign>grid,omitempty" sql:"grid"`
-	County  string `xml:"Callsign>county,omitempty" sql:"county"`
-	Fips    string `xml:"Callsign>fips,omitempty" sql:"fips"`
-	Land    string `xml:"Callsign>land,omitempty" sql:"dxcc_country"`
-	Efdate  string `xml:"Callsign>efdate,omitempty" sql:"license_issue_date"`
-	Expdate string `xml:"Callsign>expdate,omitempty" sql:"license_exp_date"`
-	P_call  string `xml:"Callsign>p_call,omitempty" sql:"prev_call"`
-	Class   string `xml:"Callsign>class,omitempty" sql:"class"`
-	Codes   string `xml:"Callsign>codes,omitempty" sql:"codes"`
-	Qslmgr  string `xml:"Callsign>qslmgr,omitempty" sql:"qslmgr"`
-	Email   string `xml:"Callsign>email,omitempty" sql:"email"`
-	Url     string `xml:"Callsign>url,omitempty"`
-	//U_views   int     `xml:"Callsign>u_views,omitempty" sql:"u_views"`
-	U_views   string `xml:"Callsign>u_views,omitempty" sql:"u_views"`
-	Bio       string `xml:"Callsign>bio,omitempty"`
-	Biodate   string `xml:"Callsign>biodate,omitempty"`
-	Image     string `xml:"Callsign>image,omitempty"`
-	Serial    string `xml:"Callsign>serial,omitempty"`
-	Moddate   string `xml:"Callsign>moddate,omitempty" sql:"mod_date"`
-	MSA       string `xml:"Callsign>MSA,omitempty" sql:"msa"`
-	AreaCode  string `xml:"Callsign>AreaCode,omitempty" sql:"area_code"`
-	TimeZone  string `xml:"Callsign>TimeZone,omitempty" sql:"time_zone"`
-	GMTOffset string `xml:"Callsign>GMTOffset,omitempty" sql:"gmt_offset"`
-	DST       string `xml:"Callsign>DST,omitempty" sql:"dst"`
-	Eqsl      string `xml:"Callsign>eqsl,omitempty" sql:"eqsl"`
-	Mqsl      string `xml:"Callsign>mqsl,omitempty" sql:"mqsl"`
-	Lotw      string `xml:"Callsign>lotw,omitempty" sql:"lotw"`
-	Cqzone    string `xml:"Callsign>cqzone,omitempty" sql:"cq_zone"`
-	Ituzone   string `xml:"Callsign>ituzone,omitempty" sql:"itu_zone"`
-	Geoloc    string `xml:"Callsign>geoloc,omitempty" sql:"geoloc"`
-	Attn      string `xml:"Callsign>attn,omitempty" sql:"attn"`
-	Nickname  string `xml:"Callsign>nickname,omitempty" sql:"nickname"`
-	Name_fmt  string `xml:"Callsign>name_fmt,omitempty" sql:"lname_fmt"`
-	//Born      int     `xml:"Callsign>born,omitempty" sql:"born"`
-	Born string `xml:"Callsign>born,omitempty" sql:"born"`
+	Call      string          `xml:"Callsign>call,omitempty" sql:"call"`
+	Aliases   string          `xml:"Callsign>aliases,omitempty" sql:"aliases"`
+	Dxcc      sql.NullInt64   `xml:"Callsign>dxcc,omitempty" sql:"dxcc_id"`
+	Fname     string          `xml:"Callsign>fname,omitempty" sql:"fname"`
+	Name      string          `xml:"Callsign>name,omitempty" sql:"lname"`
+	Addr1     string          `xml:"Callsign>addr1,omitempty" sql:"addr1"`
+	Addr2     string          `xml:"Callsign>addr2,omitempty" sql:"addr2"`
+	State     string          `xml:"Callsign>state,omitempty" sql:"state"`
+	Zip       string          `xml:"Callsign>zip,omitempty" sql:"zip"`
+	Country   string          `xml:"Callsign>country,omitempty" sql:"mail_country"`
+	Ccode     string          `xml:"Callsign>ccode,omitempty" sql:"country_code"`
+	Lat       sql.NullFloat64 `xml:"Callsign>lat,omitempty" sql:"lat"`
+	Lon       sql.NullFloat64 `xml:"Callsign>lon,omitempty" sql:"lon"`
+	Grid      string          `xml:"Callsign>grid,omitempty" sql:"grid"`
+	County    string          `xml:"Callsign>county,omitempty" sql:"county"`
+	Fips      string          `xml:"Callsign>fips,omitempty" sql:"fips"`
+	Land      string          `xml:"Callsign>land,omitempty" sql:"dxcc_country"`
+	Efdate    sql.NullTime    `xml:"Callsign>efdate,omitempty" sql:"license_issue_date"`
+	Expdate   sql.NullTime    `xml:"Callsign>expdate,omitempty" sql:"license_exp_date"`
+	P_call    string          `xml:"Callsign>p_call,omitempty" sql:"prev_call"`
+	Class     string          `xml:"Callsign>class,omitempty" sql:"class"`
+	Codes     string          `xml:"Callsign>codes,omitempty" sql:"codes"`
+	Qslmgr    string          `xml:"Callsign>qslmgr,omitempty" sql:"qslmgr"`
+	Email     string          `xml:"Callsign>email,omitempty" sql:"email"`
+	Url       string          `xml:"Callsign>url,omitempty"`
+	U_views   sql.NullInt64   `xml:"Callsign>u_views,omitempty" sql:"u_views"`
+	Bio       string          `xml:"Callsign>bio,omitempty"`
+	Biodate   sql.NullTime    `xml:"Callsign>biodate,omitempty"`
+	Image     string          `xml:"Callsign>image,omitempty"`
+	Serial    string          `xml:"Callsign>serial,omitempty"`
+	Moddate   sql.NullTime    `xml:"Callsign>moddate,omitempty" sql:"mod_date"`
+	MSA       string          `xml:"Callsign>MSA,omitempty" sql:"msa"`
+	AreaCode  string          `xml:"Callsign>AreaCode,omitempty" sql:"area_code"`
+	TimeZone  string          `xml:"Callsign>TimeZone,omitempty" sql:"time_zone"`
+	GMTOffset sql.NullFloat64 `xml:"Callsign>GMTOffset,omitempty" sql:"gmt_offset"`
+	DST       sql.NullBool    `xml:"Callsign>DST,omitempty" sql:"dst"`
+	Eqsl      sql.NullBool    `xml:"Callsign>eqsl,omitempty" sql:"eqsl"`
+	Mqsl      sql.NullBool    `xml:"Callsign>mqsl,omitempty" sql:"mqsl"`
+	Lotw      sql.NullBool    `xml:"Callsign>lotw,omitempty" sql:"lotw"`
+	Cqzone    sql.NullInt64   `xml:"Callsign>cqzone,omitempty" sql:"cq_zone"`
+	Ituzone   sql.NullInt64   `xml:"Callsign>ituzone,omitempty" sql:"itu_zone"`
+	Geoloc    string          `xml:"Callsign>geoloc,omitempty" sql:"geoloc"`
+	Attn      string          `xml:"Callsign>attn,omitempty" sql:"attn"`
+	Nickname  string          `xml:"Callsign>nickname,omitempty" sql:"nickname"`
+	Name_fmt  string          `xml:"Callsign>name_fmt,omitempty" sql:"lname_fmt"`
+	Born      sql.NullInt64   `xml:"Callsign>born,omitempty" sql:"born"`
+}
+
+// UnmarshalXML decodes a QRZ response.  QRZ sends empty elements for unknown values and
+// 0000-00-00 for unknown dates, those and anything else that doesn't parse are left null rather
+// than failing the lookup.  Flags are 1/0, except DST which is Y/N.
+func (q *QRZDatabase) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+
+	// The typed fields are shadowed by the text QRZ sent, shallower fields win
+	type plain QRZDatabase
+	var raw struct {
+		plain
+		Dxcc      string `xml:"Callsign>dxcc"`
+		Lat       string `xml:"Callsign>lat"`
+		Lon       string `xml:"Callsign>lon"`
+		Efdate    string `xml:"Callsign>efdate"`
+		Expdate   string `xml:"Callsign>expdate"`
+		U_views   string `xml:"Callsign>u_views"`
+		Biodate   string `xml:"Callsign>biodate"`
+		Moddate   string `xml:"Callsign>moddate"`
+		GMTOffset string `xml:"Callsign>GMTOffset"`
+		DST       string `xml:"Callsign>DST"`
+		Eqsl      string `xml:"Callsign>eqsl"`
+		Mqsl      string `xml:"Callsign>mqsl"`
+		Lotw      string `xml:"Callsign>lotw"`
+		Cqzone    string `xml:"Callsign>cqzone"`
+		Ituzone   string `xml:"Callsign>ituzone"`
+		Born      string `xml:"Callsign>born"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	*q = QRZDatabase(raw.plain)
+	q.Dxcc = qrzInt(raw.Dxcc)
+	q.Lat = qrzFloat(raw.Lat)
+	q.Lon = qrzFloat(raw.Lon)
+	q.Efdate = qrzDate(raw.Efdate)
+	q.Expdate = qrzDate(raw.Expdate)
+	q.U_views = qrzInt(raw.U_views)
+	q.Biodate = qrzDate(raw.Biodate)
+	q.Moddate = qrzDate(raw.Moddate)
+	q.GMTOffset = qrzFloat(raw.GMTOffset)
+	q.DST = qrzBool(raw.DST, "Y", "N")
+	q.Eqsl = qrzFlag(raw.Eqsl)
+	q.Mqsl = qrzFlag(raw.Mqsl)
+	q.Lotw = qrzFlag(raw.Lotw)
+	q.Cqzone = qrzInt(raw.Cqzone)
+	q.Ituzone = qrzInt(raw.Ituzone)
+	q.Born = qrzInt(raw.Born)
+	return nil
+}
+
+func qrzInt(s string) sql.NullInt64 {
+
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return sql.NullInt64{Int64: v, Valid: err == nil}
+}
+
+func qrzFloat(s string) sql.NullFloat64 {
+
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return sql.NullFloat64{Float64: v, Valid: err == nil}
+}
+
+func qrzFlag(s string) sql.NullBool {
+	return qrzBool(s, "1", "0")
+}
+
+func qrzBool(s, yes, no string) sql.NullBool {
+
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.EqualFold(s, yes):
+		return sql.NullBool{Bool: true, Valid: true}
+	case strings.EqualFold(s, no):
+		return sql.NullBool{Valid: true}
+	}
+	return sql.NullBool{}
+}
+
+// Dates are YYYY-MM-DD, modification times YYYY-MM-DD hh:mm:ss, both UTC.
+func qrzDate(s string) sql.NullTime {
+
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return sql.NullTime{Time: t, Valid: true}
+		}
+	}
+	return sql.NullTime{}
+}
+
+// Row returns the callsign table columns (sql tags) and values, the same shape as a row selected
+// from the callsign table.
+func (q *QRZDatabase) Row() map[string]interface{} {
+
+	cols, vals := sqlColumns(q)
+	row := make(map[string]interface{}, len(cols))
+	for i, col := range cols {
+		// Null fields as the database returns them, nil or the value
+		if v, ok := vals[i].(driver.Valuer); ok {
+			row[col], _ = v.Value()
+		} else {
+			row[col] = vals[i]
+		}
+	}
+	return row
 }
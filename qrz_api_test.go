@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestQRZDatabaseUnmarshal(t *testing.T) {
+
+	data := `<?xml version="1.0" encoding="utf-8" ?>
+<QRZDatabase version="1.34" xmlns="http://xmldata.qrz.com">
+<Callsign><call>K1ABC</call><dxcc>291</dxcc><state>MA</state><zip>02134</zip><lat>42.36</lat><lon> -71.06 </lon>
+<efdate>2019-03-01</efdate><expdate>0000-00-00</expdate><u_views></u_views><moddate>2021-06-05 14:02:11</moddate>
+<GMTOffset>-5</GMTOffset><DST>Y</DST><eqsl>1</eqsl><mqsl>0</mqsl><lotw></lotw><cqzone>5</cqzone><ituzone>x</ituzone>
+<born>1961</born></Callsign>
+<Session><Key>test-key</Key><Count>2</Count></Session>
+</QRZDatabase>`
+	var q QRZDatabase
+	if err := xml.Unmarshal([]byte(data), &q); err != nil {
+		t.Fatal(err)
+	}
+	want := QRZDatabase{Key: "test-key", Count: 2, Call: "K1ABC", Dxcc: sql.NullInt64{Int64: 291, Valid: true},
+		State: "MA", Zip: "02134", Lat: sql.NullFloat64{Float64: 42.36, Valid: true},
+		Lon:       sql.NullFloat64{Float64: -71.06, Valid: true},
+		Efdate:    sql.NullTime{Time: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+		Moddate:   sql.NullTime{Time: time.Date(2021, 6, 5, 14, 2, 11, 0, time.UTC), Valid: true},
+		GMTOffset: sql.NullFloat64{Float64: -5, Valid: true}, DST: sql.NullBool{Bool: true, Valid: true},
+		Eqsl: sql.NullBool{Bool: true, Valid: true}, Mqsl: sql.NullBool{Valid: true},
+		Cqzone: sql.NullInt64{Int64: 5, Valid: true}, Born: sql.NullInt64{Int64: 1961, Valid: true}}
+	if q != want {
+		t.Errorf("Expected %+v, got %+v", want, q)
+	}
+}
+
+func TestQRZDatabaseNulls(t *testing.T) {
+
+	// Unknown values, empty, 0000-00-00 or garbage, are bound as NULL rather than 0 or false
+	data := `<QRZDatabase><Callsign><call>K1ABC</call><dxcc/><lat/><lon></lon><expdate>0000-00-00</expdate>
+<u_views></u_views><GMTOffset/><DST/><eqsl>0</eqsl><lotw/><cqzone/><ituzone>x</ituzone><born/></Callsign>
+</QRZDatabase>`
+	var q QRZDatabase
+	if err := xml.Unmarshal([]byte(data), &q); err != nil {
+		t.Fatal(err)
+	}
+	cols, _ := sqlColumns(&q)
+	bound := make(map[string]interface{})
+	for i, v := range bindParams(&q) {
+		if vr, ok := v.(driver.Valuer); ok {
+			v, _ = vr.Value()
+		}
+		bound[cols[i]] = v
+	}
+	for _, col := range []string{"dxcc_id", "lat", "lon", "license_issue_date", "license_exp_date", "u_views",
+		"mod_date", "gmt_offset", "dst", "mqsl", "lotw", "cq_zone", "itu_zone", "born"} {
+		if bound[col] != nil {
+			t.Errorf("%s: expected NULL, got %v", col, bound[col])
+		}
+	}
+	if bound["call"] != "K1ABC" || bound["eqsl"] != false {
+		t.Errorf("Unexpected values %v", bound)
+	}
+	if row := q.Row(); row["lat"] != nil || row["eqsl"] != false {
+		t.Errorf("Expected the row to match the bound values, got %v", row)
+	}
+}
@@ -1,24 +1,28 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	_ "github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/kinesis"
-	"github.com/disney/quanta/shared"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/hamba/avro"
 	"github.com/reiver/go-telnet"
+	"gitlab.disney.com/guys-workspace/rbn-to-kinesis/bandplan"
 	"gitlab.disney.com/guys-workspace/rbn-to-kinesis/callparser"
+	"gitlab.disney.com/guys-workspace/rbn-to-kinesis/capture"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"log"
-	"math"
+	"net/http"
 	"os"
-	"regexp"
-	"strconv"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -31,251 +35,574 @@ var (
 // Exit Codes
 const (
 	Success = 0
-	Select  = "select * from callsign where call = ?"
-	Alias   = "select * from callsign where aliases like ?"
-	Insert  = "insert into callsign (%s) values (%s)"
 )
 
 // Main strct defines command line arguments variables and various global meta-data associated with record loads.
 type Main struct {
-	RBNHost    string
-	RBNPort    int
-	Stream     string
-	Region     string
-	DBHostPort string
-	DBUser     string
-	DBSchema   string
-	SelectStmt *sql.Stmt
-	InsertStmt *sql.Stmt
-	AliasStmt  *sql.Stmt
+	*Config
+	SCP         *callparser.SCPWatcher
+	Scorer      *Scorer
+	Calibrator  *Calibrator
+	Aggregator  *Aggregator
+	Sink        Sink
+	RawSink     Sink
+	Capture     *capture.Writer
+	Deps        Deps
+	Store       CallsignStore
+	QRZ         *QRZClient
+	SkipQRZ     bool // resolve calls from the callsign database only
+	Bands       *bandplan.Plan
+	Segments    *bandplan.SegmentMap
+	spotSchema  avro.Schema
+	heardSchema avro.Schema
+	flushMu     sync.Mutex
+	// Closed by Close to stop the background reloads and save the calibration estimates
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+// Deps - Services to use instead of connecting to the ones in the config, i.e. fakes in tests.  Nil
+// fields are connected to as configured.
+type Deps struct {
+	Kinesis kinesisiface.KinesisAPI
+	Store   CallsignStore
 }
 
 // NewMain allocates a new pointer to Main struct with empty record counter
-func NewMain() *Main {
-	return &Main{}
+func NewMain(config *Config) *Main {
+	return &Main{Config: config, Bands: bandplan.Default(), Segments: bandplan.DefaultSegments(),
+		stop: make(chan struct{})}
 }
 
 func main() {
 
-	app := kingpin.New(os.Args[0], "RBN to Kinesis Bridge").DefaultEnvars()
+	app := kingpin.New("rbn-to-kinesis", "RBN to Kinesis Bridge").DefaultEnvars()
 	app.Version("Version: " + Version + "\nBuild: " + Build)
 
-	stream := app.Arg("stream", "Kinesis stream name.").Required().String()
-	dbHostPort := app.Arg("db-host-port", "Quanta host:port").Required().String()
-	dbUser := app.Arg("db-user", "Quanta user").Required().String()
-	rbnHost := app.Arg("rbn-host", "Host for RBN endpoint.").Default("telnet.reversebeacon.net").String()
-	rbnPort := app.Arg("rbn-port", "Port number for service").Default("7000").Int32()
-	rbnClientCall := app.Arg("rbn-client-call", "RBN login call").Default("N7ZG").String()
-	region := app.Arg("region", "AWS region").Default("us-east-1").String()
-	dbSchema := app.Arg("db-schema", "Quanta database").Default("quanta").String()
-
-	splitex := regexp.MustCompile("[[:space:]]+")
-	kingpin.MustParse(app.Parse(os.Args[1:]))
-
-	main := NewMain()
-	main.RBNHost = *rbnHost
-	main.RBNPort = int(*rbnPort)
-	main.Region = *region
-	main.Stream = *stream
-	main.DBHostPort = *dbHostPort
-	main.DBUser = *dbUser
-	main.DBSchema = *dbSchema
-
-	log.Printf("RBN host %v.\n", main.RBNHost)
-	log.Printf("RBN port %d.\n", main.RBNPort)
-	log.Printf("AWS region %s.\n", main.Region)
-	log.Printf("Kinesis stream %s.\n", main.Stream)
-	log.Printf("DB host:port %s.\n", main.DBHostPort)
-	log.Printf("DB user %s.\n", main.DBUser)
-	log.Printf("DB schema %s.\n", main.DBSchema)
-
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(main.Region),
-	})
-
+	config := DefaultConfig()
+	flags := NewConfigFlags(app, config)
+
+	live := app.Command("run", "Bridge the live RBN telnet feed (default).").Default()
+	backfill := app.Command("backfill", "Import spots from the RBN raw data archive.")
+	archiveSource := backfill.Flag("source", "Directory or URL of the daily archive files, {date} is replaced by YYYYMMDD.").
+		Default(RBNArchiveURL).String()
+	fromDate := backfill.Flag("from", "First day to import (YYYY-MM-DD).").Required().String()
+	toDate := backfill.Flag("to", "Last day to import (YYYY-MM-DD), defaults to --from.").String()
+	progressFile := backfill.Flag("progress-file", "File recording import progress so an interrupted backfill resumes.").String()
+	skipQRZ := backfill.Flag("skip-qrz", "Resolve calls from the callsign database only, without QRZ lookups.").Bool()
+	replay := app.Command("replay", "Feed a capture recorded with --capture-file through the pipeline.")
+	captureFile := replay.Arg("capture", "Capture file to replay.").Required().ExistingFile()
+	replaySpeed := replay.Flag("speed", "Multiple of the original pace, 0 replays as fast as possible.").Default("1").Float64()
+	migrateCmd := app.Command("migrate", "Bring the callsign database schema up to date.")
+	dryRun := migrateCmd.Flag("dry-run", "List the pending migrations and their SQL without applying them.").Bool()
+
+	command, err := flags.Parse(os.Args[1:])
 	if err != nil {
-		log.Fatal(err)
+		app.Fatalf("%v", err)
 	}
 
-	kc := kinesis.New(sess)
-	streamName := aws.String(main.Stream)
-	_, err = kc.DescribeStream(&kinesis.DescribeStreamInput{StreamName: streamName})
-
-	//if no stream name in AWS
-	if err != nil {
-		log.Fatal(err)
+	if flags.Print {
+		fmt.Print(config)
+		os.Exit(Success)
+	}
+	if command == migrateCmd.FullCommand() {
+		if err := config.DB.Validate(); err != nil {
+			app.Fatalf("%v", err)
+		}
+		migrations, err := MigrateCallsignDB(config.DB, *dryRun)
+		for _, m := range migrations {
+			if *dryRun {
+				fmt.Printf("-- %04d_%s\n%s\n", m.Version, m.Name, m.SQL)
+			} else {
+				log.Printf("Applied migration %04d_%s.", m.Version, m.Name)
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(migrations) == 0 {
+			log.Printf("Callsign database is up to date.")
+		}
+		return
+	}
+	if err := config.Validate(); err != nil {
+		app.Fatalf("%v", err)
+	}
+	// Backfills can do without QRZ, calls not in the callsign database are left unresolved
+	if command == backfill.FullCommand() {
+		*skipQRZ = *skipQRZ || config.Callbook.QRZ.Validate() != nil
+	} else if err := config.Callbook.QRZ.Validate(); err != nil {
+		app.Fatalf("%v", err)
 	}
 
-	schema, err := avro.Parse(`{
-	    "type": "record",
-	    "name": "spot_events",
-	    "namespace": "quanta",
-	    "fields" : [
-	        {"name": "band", "type": "string"},
-	        {"name": "callsign", "type": "string"},
-	        {"name": "de_cont", "type": "string"},
-	        {"name": "de_pfx", "type": "string"},
-	        {"name": "dx", "type": "string"},
-	        {"name": "dx_cont", "type": "string"},
-	        {"name": "dx_pfx", "type": "string"},
-	        {"name": "freq", "type": "double"},
-	        {"name": "mode", "type": "string"},
-	        {"name": "tx_mode", "type": "string"},
-	        {"name": "db", "type": "int"},
-	        {"name": "speed", "type": "int"},
-	        {"name": "date", "type": "long"}
-	    ]
-	}`)
+	if command == live.FullCommand() {
+		// Finish open files on the way out
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		if err := Run(ctx, config, Deps{}); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	if err != nil {
+	main := NewMain(config)
+	main.SkipQRZ = *skipQRZ
+	if err := main.Init(); err != nil {
 		log.Fatal(err)
 	}
+	defer main.Close()
 
-	conn, err := telnet.DialTo("telnet.reversebeacon.net:7000")
-	if nil != err {
-		log.Fatal(err)
+	switch command {
+	case backfill.FullCommand():
+		from, err := time.Parse("2006-01-02", *fromDate)
+		if err != nil {
+			app.Fatalf("bad --from date: %v", err)
+		}
+		to := from
+		if *toDate != "" {
+			if to, err = time.Parse("2006-01-02", *toDate); err != nil {
+				app.Fatalf("bad --to date: %v", err)
+			}
+		}
+		progress, err := LoadProgress(*progressFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		archive := &Archive{Source: *archiveSource, Client: &http.Client{Timeout: 10 * time.Minute}}
+		if err := main.Backfill(archive, from, to, progress); err != nil {
+			log.Fatal(err)
+		}
+	case replay.FullCommand():
+		if *replaySpeed < 0 {
+			app.Fatalf("--speed cannot be negative")
+		}
+		if err := main.Replay(*captureFile, *replaySpeed); err != nil {
+			log.Fatal(err)
+		}
 	}
+}
 
-	log.Printf("Connected.")
+// Run bridges the live RBN feed to the configured sinks until ctx is done.  Services in deps are
+// used instead of connecting to the ones in the config.
+func Run(ctx context.Context, config *Config, deps Deps) error {
 
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:@tcp(%s)/%s", main.DBUser, main.DBHostPort, main.DBSchema))
-	if err != nil {
-		log.Print(err.Error())
+	m := NewMain(config)
+	m.Deps = deps
+	if err := m.Init(); err != nil {
+		// Stop whatever was started before the failure
+		m.Close()
+		return err
+	}
+	defer m.Close()
+	if config.Source.RBN.CaptureFile != "" {
+		cw, err := capture.NewWriter(config.Source.RBN.CaptureFile)
+		if err != nil {
+			return err
+		}
+		m.Capture = cw
+		log.Printf("Recording raw lines to %s.\n", config.Source.RBN.CaptureFile)
 	}
-	defer db.Close()
+	return m.Live(ctx)
+}
 
-	main.SelectStmt, err = db.Prepare(Select)
-	if err != nil {
-		log.Fatal(err)
+// Init loads reference data, connects to the callsign database and the sinks and sets up the
+// spot pipeline.
+func (m *Main) Init() error {
+
+	if m.BandPlan.File != "" {
+		plan, err := bandplan.Load(m.BandPlan.File)
+		if err != nil {
+			return err
+		}
+		m.Bands = plan
+	}
+	if m.BandPlan.SegmentsFile != "" {
+		segments, err := bandplan.LoadSegments(m.BandPlan.SegmentsFile)
+		if err != nil {
+			return err
+		}
+		m.Segments = segments
+	}
+	if err := m.startCountryReloader(); err != nil {
+		return err
+	}
+	m.QRZ = NewQRZClient(m.Callbook.QRZ)
+	StartMetrics(m.Metrics.Listen)
+
+	log.Printf("RBN host %v.\n", m.Source.RBN.Host)
+	log.Printf("RBN port %d.\n", m.Source.RBN.Port)
+	log.Printf("AWS region %s.\n", m.Sinks.Kinesis.Region)
+	log.Printf("Kinesis stream %s.\n", m.Sinks.Kinesis.Stream)
+	log.Printf("DB driver %s.\n", m.DB.Driver)
+	log.Printf("DB host:port %s.\n", m.DB.HostPort)
+	log.Printf("DB user %s.\n", m.DB.User)
+	log.Printf("DB schema %s.\n", m.DB.Schema)
+
+	if err := m.openSinks(); err != nil {
+		return err
 	}
-	defer main.SelectStmt.Close()
 
-	main.AliasStmt, err = db.Prepare(Alias)
-	if err != nil {
-		log.Fatal(err)
+	var err error
+	if m.spotSchema, err = avro.Parse(SpotSchema); err != nil {
+		return err
+	}
+	if m.Aggregate.Enabled {
+		m.Aggregator = NewAggregator(m.Aggregate.Window, m.Aggregate.FreqTolerance)
+		if m.heardSchema, err = avro.Parse(DxHeardSchema); err != nil {
+			return err
+		}
 	}
-	defer main.AliasStmt.Close()
 
-	main.InsertStmt, err = db.Prepare(shared.GenerateSQLInsert("callsign", &QRZDatabase{}))
-	if err != nil {
-		log.Fatal(err)
+	if m.Store = m.Deps.Store; m.Store == nil {
+		if m.Store, err = OpenCallsignStore(m.DB); err != nil {
+			return err
+		}
 	}
-	defer main.InsertStmt.Close()
 
-	log.Print(ReaderTelnet(conn, "Please enter your call:"))
-	WriterTelnet(conn, *rbnClientCall)
-	for {
-		record := make(map[string]interface{})
-		str := ReaderTelnet(conn, "\r\n")
-		s := splitex.Split(str, 13)
-		if len(s) < 10 || s[2] == "de" {
-			continue
+	if m.Callbook.SCP.File != "" {
+		if m.SCP, err = callparser.NewSCPWatcher(m.Callbook.SCP.File); err != nil {
+			return err
 		}
-		c := strings.Split(s[2], "-")
-		call := strings.TrimRight(c[0], "0123456789")
+		m.background(func() { m.SCP.Run(m.Callbook.SCP.ReloadInterval, m.stop) })
+	}
+	m.Scorer = NewScorer(m.Scoring.Window, m.Scoring.FreqTolerance, m.inSCP)
 
-		record["callsign"] = call
-		if freq, err := strconv.ParseFloat(s[3], 64); err != nil {
-			continue
-		} else {
-			f := Round(freq, .1)
-			i := fmt.Sprintf("%.2f", f)
-			record["freq"], _ = strconv.ParseFloat(i, 64)
-		}
-		record["dx"] = s[4]
-		record["mode"] = s[5]
-		if strength, err2 := strconv.ParseInt(s[6], 10, 64); err2 != nil {
-			log.Printf("STRENGTH ERR %v\n", s[6])
-			continue
-		} else {
-			record["db"] = int(strength)
+	m.Calibrator = NewCalibrator(m.Calibration.Window, m.Calibration.FreqTolerance)
+	if m.Calibration.StateFile != "" {
+		if err := m.Calibrator.Load(m.Calibration.StateFile); err != nil {
+			return err
 		}
-		if speed, err3 := strconv.ParseInt(s[8], 10, 32); err3 != nil {
-			log.Printf("SPEED ERR %v\n", s[8])
-			continue
-		} else {
-			record["speed"] = int(speed)
+		m.background(func() { m.Calibrator.Run(m.Calibration.StateFile, m.Calibration.SaveInterval, m.stop) })
+	}
+	if m.Calibration.OverrideFile != "" {
+		if err := m.Calibrator.LoadOverrides(m.Calibration.OverrideFile); err != nil {
+			return err
+		}
+	}
+	PublishCalibration(m.Calibrator)
+	return nil
+}
+
+// Connect to every configured sink.
+func (m *Main) openSinks() error {
+
+	var sinks MultiSink
+	if m.Sinks.Kinesis.Stream != "" {
+		kc := m.Deps.Kinesis
+		if kc == nil {
+			sess, err := session.NewSession(&aws.Config{
+				Region: aws.String(m.Sinks.Kinesis.Region),
+			})
+			if err != nil {
+				return err
+			}
+			kc = kinesis.New(sess)
+		}
+		sink, err := NewKinesisSink(kc, m.Sinks.Kinesis.Stream)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+		if m.Aggregate.Enabled && m.Sinks.Kinesis.RawStream != "" {
+			if m.RawSink, err = NewKinesisSink(kc, m.Sinks.Kinesis.RawStream); err != nil {
+				return err
+			}
+		}
+	}
+	if m.Sinks.Parquet.Dir != "" {
+		sink, err := NewParquetSink(m.Sinks.Parquet.Dir, m.Sinks.Parquet.MaxBytes)
+		if err != nil {
+			return err
+		}
+		log.Printf("Parquet directory %s.\n", m.Sinks.Parquet.Dir)
+		sinks = append(sinks, sink)
+	}
+	if m.Sinks.Avro.Dir != "" {
+		sink, err := NewAvroFileSink(m.Sinks.Avro.Dir, m.Sinks.Avro.Codec, m.Sinks.Avro.RollInterval,
+			m.Sinks.Avro.MaxBytes)
+		if err != nil {
+			return err
+		}
+		log.Printf("Avro directory %s (%s).\n", m.Sinks.Avro.Dir, m.Sinks.Avro.Codec)
+		sinks = append(sinks, sink)
+	}
+	if m.Sinks.S3.Bucket != "" {
+		client, err := NewS3Client(m.Sinks.S3)
+		if err != nil {
+			return err
+		}
+		sink, err := NewS3Sink(client, m.Sinks.S3)
+		if err != nil {
+			return err
 		}
-		record["tx_mode"] = s[10]
-		timeStr := s[11]
-		if timeStr == "B" {
-			timeStr = strings.TrimSpace(s[12])
+		log.Printf("S3 bucket %s.\n", m.Sinks.S3.Bucket)
+		sinks = append(sinks, sink)
+	}
+	m.Sink = sinks
+	return nil
+}
+
+// Close publishes the dx_heard events of every open window, flushes the sinks and releases the
+// database connection.
+func (m *Main) Close() {
+
+	if m.Aggregator != nil && m.Sink != nil {
+		if err := m.flush(time.Now().UTC().Add(m.Aggregate.Window)); err != nil {
+			log.Printf("Flushing dx_heard events failed: %v", err)
 		}
-		if !strings.HasSuffix(timeStr, "Z") || len(timeStr) != 5 {
-			log.Printf("TIME ERR [%v] - %v\n", s[11], str)
+	}
+	for _, sink := range []Sink{m.Sink, m.RawSink} {
+		if sink == nil {
 			continue
 		}
-		hr := timeStr[0:2]
-		mn := timeStr[2:4]
-		hri, _ := strconv.ParseInt(hr, 10, 64)
-		mni, _ := strconv.ParseInt(mn, 10, 64)
-		x := time.Now().UTC()
-		y := time.Date(x.Year(), x.Month(), x.Day(), int(hri), int(mni), 0, 0, time.UTC)
-		// Adjust for clock skew
-		if x.Hour() == 0 && hri == 23 {
-			y.AddDate(0, 0, -1)
+		if err := sink.Close(); err != nil {
+			log.Printf("Sink close failed: %v", err)
 		}
-		if x.Hour() == 23 && hri == 0 {
-			y.AddDate(0, 0, 1)
+	}
+
+	// Stop the reloads and wait for the calibration estimates to be saved
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	m.workers.Wait()
+
+	if m.Capture != nil {
+		if err := m.Capture.Close(); err != nil {
+			log.Printf("Capture close failed: %v", err)
 		}
-		record["date"] = y.Unix() * 1000
-		//log.Printf(">%v", y)
+	}
+
+	// An injected store belongs to the caller
+	if m.Store != nil && m.Deps.Store == nil {
+		m.Store.Close()
+	}
+}
+
+// Live reads spots from the RBN telnet feed until ctx is done, reconnecting when the connection
+// drops.  An error means the pipeline can't continue.
+func (m *Main) Live(ctx context.Context) error {
 
-		deRow, err := main.getAndInsertRowForCall(record["callsign"].(string))
+	if m.Aggregator == nil {
+		return m.live(ctx)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	flushed := make(chan error, 1)
+	go func() {
+		flushed <- m.flushEvery(ctx, cancel, m.flushInterval())
+	}()
+	err := m.live(ctx)
+	cancel()
+	if ferr := <-flushed; err == nil {
+		err = ferr
+	}
+	return err
+}
+
+func (m *Main) live(ctx context.Context) error {
+
+	delay := m.Source.RBN.ReconnectDelay
+	for {
+		lines, err := m.session(ctx)
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		// Back off while the feed keeps failing, start over once it delivered spots again
+		if lines > 0 {
+			delay = m.Source.RBN.ReconnectDelay
 		}
+		log.Printf("Reconnecting in %v.", delay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > m.Source.RBN.MaxReconnectDelay {
+			delay = m.Source.RBN.MaxReconnectDelay
+		}
+	}
+}
+
+// Log in and process lines until the connection drops or ctx is done.  Returns the number of
+// lines read, connection failures are logged rather than returned.
+func (m *Main) session(ctx context.Context) (int, error) {
 
-		dxRow, errx := main.getAndInsertRowForCall(record["dx"].(string))
-		if errx != nil {
-			log.Fatal(errx)
+	conn, err := telnet.DialTo(fmt.Sprintf("%s:%d", m.Source.RBN.Host, m.Source.RBN.Port))
+	if err != nil {
+		log.Printf("RBN connect failed: %v", err)
+		return 0, nil
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
 		}
-		_ = deRow
-		_ = dxRow
+		conn.Close()
+	}()
+
+	log.Printf("Connected.")
 
-		err = Decorate(record)
+	prompt, err := ReaderTelnet(conn, "Please enter your call:")
+	m.record(prompt, time.Now().UTC())
+	if err != nil {
+		log.Printf("RBN login failed: %v", err)
+		return 0, nil
+	}
+	log.Print(prompt)
+	WriterTelnet(conn, m.Source.RBN.ClientCall)
+	for lines := 0; ; lines++ {
+		str, err := ReaderTelnet(conn, "\r\n")
+		now := time.Now().UTC()
+		m.record(str, now)
 		if err != nil {
-			log.Printf("%v", err)
-			continue
+			// A line cut off by the disconnect is dropped
+			if ctx.Err() == nil {
+				log.Printf("RBN connection lost: %v", err)
+			}
+			return lines, nil
 		}
-		data, err := avro.Marshal(schema, record)
-		if err != nil {
-			log.Fatal(err)
+		if err := m.handleLine(str, now); err != nil {
+			return lines, err
 		}
+	}
+}
+
+// Replay feeds a capture recorded with --capture-file through the pipeline at speed times the
+// original pace, 0 for as fast as possible.
+func (m *Main) Replay(path string, speed float64) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var last time.Time
+	err = capture.Read(f, speed, func(line string, at time.Time) error {
+		last = at
+		return m.handleLine(line, at)
+	})
+	if err != nil {
+		return err
+	}
+	if m.Aggregator != nil && !last.IsZero() {
+		return m.flush(last.Add(m.Aggregate.Window))
+	}
+	return nil
+}
+
+// Parse and publish one line from the feed, lines that are not spots are skipped.
+func (m *Main) handleLine(str string, now time.Time) error {
+
+	record, err := ParseSpot(str, now)
+	if err != nil {
+		spotsReceived.Add(1)
+		log.Printf("%v", err)
+		return nil
+	}
+	if record == nil {
+		return nil
+	}
+	spotsReceived.Add(1)
+	return m.Process(record, now)
+}
 
-		// put data to stream
-		putOutput, err := kc.PutRecord(&kinesis.PutRecordInput{
-			Data:         data,
-			StreamName:   aws.String(main.Stream),
-			PartitionKey: aws.String(y.Format(time.RFC3339)),
-		})
+// Append a raw line to the capture file, if recording.
+func (m *Main) record(str string, now time.Time) {
 
+	if m.Capture == nil || str == "" {
+		return
+	}
+	if err := m.Capture.Record(str, now); err != nil {
+		log.Printf("Capture failed: %v", err)
+	}
+}
+
+// Load the country file and keep it current.  SIGHUP forces a reload.
+func (m *Main) startCountryReloader() error {
+
+	format := callparser.DetectFormat(m.Country.File)
+	if m.Country.Format != "" {
+		var err error
+		if format, err = callparser.ParseFormat(m.Country.Format); err != nil {
+			return err
+		}
+	}
+	reloader, err := callparser.NewReloader(m.Country.File, m.Country.UpdateURL, format)
+	if err != nil {
+		return err
+	}
+	log.Printf("Country file version %s.\n", callparser.Version())
+	if m.Country.ClubLogFile != "" {
+		cl, err := callparser.LoadClubLog(m.Country.ClubLogFile)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		_ = *putOutput
-		//log.Printf("%v\n", *putOutput)
-		//log.Printf("%#v", record)
+		callparser.SetClubLog(cl)
+		log.Printf("Club Log data dated %s.\n", cl.Date)
+	}
+	if m.Country.File == "" && m.Country.UpdateURL == "" {
+		return nil
 	}
+	m.background(func() { reloader.Run(m.Country.ReloadInterval, m.Country.UpdateInterval, m.stop) })
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	m.background(func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-hup:
+				if err := reloader.Reload(); err != nil {
+					log.Printf("Country file reload failed: %v", err)
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// Run f in the background until Close.
+func (m *Main) background(f func()) {
+
+	m.workers.Add(1)
+	go func() {
+		defer m.workers.Done()
+		f()
+	}()
+}
+
+// True if an SCP list is loaded and has the call.
+func (m *Main) inSCP(call string) bool {
+	return m.SCP != nil && m.SCP.Contains(call)
 }
 
-// Thin function reads from Telnet session. "expect" is a string I use as signal to stop reading
-func ReaderTelnet(conn *telnet.Conn, expect string) (out string) {
+// ReaderTelnet reads from the Telnet session up to and including expect, or until the connection
+// fails, with what was read so far.
+func ReaderTelnet(conn *telnet.Conn, expect string) (out string, err error) {
 	var buffer [1]byte
 	recvData := buffer[:]
 	var n int
-	var err error
 
 	for {
 		n, err = conn.Read(recvData)
-		//fmt.Println("Bytes: ", n, "Data: ", recvData, string(recvData))
-		if n <= 0 || err != nil || strings.Contains(out, expect) {
-			break
-		} else {
-			out += string(recvData)
+		if n > 0 {
+			out += string(recvData[:n])
+			if strings.HasSuffix(out, expect) {
+				return out, nil
+			}
+		}
+		if err != nil {
+			return out, err
 		}
 	}
-	return out
 }
 
 // convert a command to bytes, and send to Telnet connection followed by '\r\n'
@@ -294,119 +621,83 @@ func WriterTelnet(conn *telnet.Conn, command string) {
 	conn.Write(crlf)
 }
 
-func Round(x, unit float64) float64 {
-	return math.Round(x/unit) * unit
-}
-
-func Decorate(record map[string]interface{}) error {
+// Decorate adds the prefix, continent, region, state, band and segment of the de and dx calls to
+// record.
+func (m *Main) Decorate(record map[string]interface{}) error {
 
-	de := callparser.NewStation(record["callsign"].(string))
+	// Resolve as of the spot time so archive backfills get the entity valid back then
+	spotTime := time.Unix(0, record["date"].(int64)*int64(time.Millisecond)).UTC()
+	de := callparser.NewStationAt(record["callsign"].(string), spotTime)
 	if de.Valid {
 		record["de_pfx"] = de.PrimaryPrefix
 		record["de_cont"] = de.Continent
+		record["de_region"] = de.Region()
+		record["de_state"] = resolveState(de, record["de_state"])
 	} else {
 		return fmt.Errorf("PrefixMapper: cannot locate prefix for '%s'.", record["callsign"])
 	}
-	dx := callparser.NewStation(record["dx"].(string))
+	dx := callparser.NewStationAt(record["dx"].(string), spotTime)
 	if dx.Valid {
 		record["dx_pfx"] = dx.PrimaryPrefix
 		record["dx_cont"] = dx.Continent
+		record["dx_region"] = dx.Region()
+		record["dx_state"] = resolveState(dx, record["dx_state"])
 	} else {
 		return fmt.Errorf("PrefixMapper: cannot locate prefix for '%s'.", record["dx"])
 	}
 
-	freq := record["freq"].(float64)
-
-	if freq >= 1800.0 && freq <= 2000.0 {
-		record["band"] = "160m"
-	} else if freq >= 3500.0 && freq <= 4000.0 {
-		record["band"] = "80m"
-	} else if freq >= 5300.0 && freq <= 5500.0 {
-		record["band"] = "60m"
-	} else if freq >= 7000.0 && freq <= 7300.0 {
-		record["band"] = "40m"
-	} else if freq >= 10100.0 && freq <= 10150.0 {
-		record["band"] = "30m"
-	} else if freq >= 14000.0 && freq <= 14300.0 {
-		record["band"] = "20m"
-	} else if freq >= 18068.0 && freq <= 18168.0 {
-		record["band"] = "17m"
-	} else if freq >= 21000.0 && freq <= 21450.0 {
-		record["band"] = "15m"
-	} else if freq >= 24890.0 && freq <= 24990.0 {
-		record["band"] = "12m"
-	} else if freq >= 28000.0 && freq <= 30000.0 {
-		record["band"] = "10m"
-	} else if freq >= 50000.0 && freq <= 54000.0 {
-		record["band"] = "6m"
-	} else if freq >= 69900.0 && freq <= 70500.0 {
-		record["band"] = "4m"
-	} else if freq >= 472 && freq <= 479 {
-		record["band"] = "600m"
-	} else if freq >= 135.7 && freq <= 137.8 {
-		record["band"] = "2200m"
-	} else if freq >= 144000.0 && freq <= 148000.0 {
-		record["band"] = "2m"
-	} else if freq >= 219000.0 && freq <= 225000.0 {
-		record["band"] = "1.25m"
-	} else if freq >= 420000.0 && freq <= 450000.0 {
-		record["band"] = "70cm"
-	} else if freq >= 902000.0 && freq <= 928000.0 {
-		record["band"] = "33cm"
-	} else if freq >= 1240000.0 && freq <= 1300000.0 {
-		record["band"] = "23cm"
-	} else {
-		return fmt.Errorf("Cannot acertain band for '%.1f'.", freq)
-	}
+	// Out of band spots are tagged rather than dropped, band is empty if outside every band
+	region := m.Bands.Region(de.PrimaryPrefix, de.Continent, de.Ituz)
+	band, inBand := m.Bands.Lookup(record["freq"].(float64), region)
+	record["band"] = band
+	record["out_of_band"] = !inBand
+	record["segment"] = m.Segments.Lookup(record["freq"].(float64), record["mode"].(string), region)
 	return nil
 }
 
-func (m *Main) getRowByCall(call string) (map[string]interface{}, error) {
+// State or province of a station.  The call area wins if it determines the state, otherwise the
+// state on file (local DB or QRZ) is used if it's consistent with the call area, so W1ABC/6 is
+// placed in CA regardless of the home address.
+func resolveState(st *callparser.Station, onFile interface{}) string {
 
-	rows, err := m.SelectStmt.Query(strings.TrimSpace(call))
-	if rows != nil {
-		defer rows.Close()
+	if state := st.State(); state != "" {
+		return state
 	}
-	if err != nil && err != sql.ErrNoRows {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
+	hint, _ := onFile.(string)
+	if hint == "" {
+		return ""
 	}
-
-	ret, errx := shared.GetAllRows(rows)
-	if errx != nil {
-		return nil, errx
+	states := st.States()
+	if len(states) == 0 {
+		return hint
 	}
-	if len(ret) > 0 {
-		return ret[0], nil
+	for _, s := range states {
+		if strings.EqualFold(s, hint) {
+			return s
+		}
 	}
+	return ""
+}
 
-	aliasRows, err := m.AliasStmt.Query(strings.TrimSpace(call))
-	if aliasRows != nil {
-		defer aliasRows.Close()
-	}
-	if err != nil && err != sql.ErrNoRows {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
+// State column of a callsign row, if any.
+func rowState(row map[string]interface{}) string {
+
+	if row == nil {
+		return ""
 	}
-	ret2, err := shared.GetAllRows(aliasRows)
-	for _, v := range ret2 {
-		aliases := v["aliases"]
-		if aliases != nil {
-			if strings.Contains(aliases.(string), call) {
-				//realCall := v["call"].(string)
-				//log.Printf("Found %s in local DB as an alias for %s", realCall, call)
-				return v, nil
-			}
-		}
+	switch v := row["state"].(type) {
+	case string:
+		return strings.ToUpper(strings.TrimSpace(v))
+	case []byte:
+		return strings.ToUpper(strings.TrimSpace(string(v)))
 	}
-	return nil, nil
+	return ""
 }
 
-func (m *Main) getAndInsertRowForCall(call string) (map[string]interface{}, error) {
+// Row of call from the callsign database, looked up on QRZ and inserted if it isn't on file and
+// remote is set.  An error is a database or QRZ login failure, other QRZ failures are logged and
+// return no row.
+func (m *Main) getAndInsertRowForCall(call string, remote bool) (map[string]interface{}, error) {
 
 	s := strings.Split(call, "/")
 	call = s[0]
@@ -414,31 +705,29 @@ func (m *Main) getAndInsertRowForCall(call string) (map[string]interface{}, erro
 		return nil, nil
 	}
 
-	row, err := m.getRowByCall(call)
+	row, err := m.Store.Get(call)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("callsign lookup of %s failed: %v", call, err)
 	}
 
-	if row == nil {
+	if row == nil && remote && !m.SkipQRZ {
 		// lookup call via QRZ API
-		qrz, qerr := GetCallFromQRZ(call)
+		qrz, qerr := m.QRZ.GetCall(call)
+		if errors.Is(qerr, errQRZLogin) {
+			return nil, qerr
+		}
 		if qerr != nil {
 			if !strings.HasPrefix(qerr.Error(), "Ignoring") {
 				log.Println(qerr)
 			}
 			return nil, nil
-			// What next?
-		} else {
-			if strings.Contains(qrz.Aliases, call) && row != nil {
-				log.Printf("Call [%s] is an alias for [%s]", call, qrz.Call)
-			} else {
-				log.Printf("Call [%s] not found, inserting. [%s]", call, qrz.Call)
-				// insert into callsign table
-				if _, err := m.InsertStmt.Exec(shared.BindParams(qrz)...); err != nil {
-					log.Fatal(err)
-				}
-			}
 		}
+		log.Printf("Call [%s] not found, inserting. [%s]", call, qrz.Call)
+		// insert into callsign table
+		if err := m.Store.Insert(qrz); err != nil {
+			return nil, fmt.Errorf("callsign insert of %s failed: %v", qrz.Call, err)
+		}
+		row = qrz.Row()
 	}
-	return row, err
+	return row, nil
 }
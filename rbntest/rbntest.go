@@ -0,0 +1,278 @@
+// Package rbntest provides a local stand-in for the RBN telnet server so tests of login, reconnect,
+// parsing and publishing run without network access.  Like httptest it is only meant for tests.
+package rbntest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.disney.com/guys-workspace/rbn-to-kinesis/capture"
+)
+
+// Prompt is sent on connect, the client answers with its call.
+const Prompt = "Please enter your call:"
+
+// Script - Drives one connection after login.  Returning ends the session with a normal close.
+type Script func(s *Session) error
+
+// Server - Fake RBN telnet server listening on a loopback port.  Every connection is prompted for a
+// call, sent the banner and then handed to the script.
+type Server struct {
+	Addr   string
+	Script Script
+	// Banner lines sent after login, {call} is replaced by the call given
+	Banner []string
+
+	listener net.Listener
+	mu       sync.Mutex
+	calls    []string
+	conns    map[net.Conn]bool
+	sessions int
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server running script for each connection.
+func NewServer(script Script) *Server {
+
+	s := NewUnstartedServer(script)
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server that can be adjusted, i.e. its Banner, before Start.
+func NewUnstartedServer(script Script) *Server {
+
+	return &Server{
+		Script: script,
+		Banner: []string{
+			"",
+			"Hello {call}, this is the Reverse Beacon Network test server.",
+			"",
+			"{call} de RELAY-TEST >",
+		},
+		conns: make(map[net.Conn]bool),
+	}
+}
+
+// Start listens on a free loopback port and accepts connections in the background.
+func (s *Server) Start() {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("rbntest: cannot listen: %v", err))
+	}
+	s.listener = l
+	s.Addr = l.Addr().String()
+	s.wg.Add(1)
+	go s.accept()
+}
+
+// HostPort returns the host and port of the listener, for the client configuration.
+func (s *Server) HostPort() (string, int) {
+
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// Calls returns the calls given at login, in connection order.
+func (s *Server) Calls() []string {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// Sessions counts connections accepted so far.
+func (s *Server) Sessions() int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions
+}
+
+// Close stops listening, drops open connections and waits for their scripts to return.
+func (s *Server) Close() {
+
+	s.listener.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.sessions++
+		n := s.sessions
+		s.conns[conn] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serve(conn, n)
+	}
+}
+
+func (s *Server) serve(conn net.Conn, n int) {
+
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	session := &Session{N: n, conn: conn}
+	if _, err := io.WriteString(conn, Prompt+" "); err != nil {
+		return
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	session.Call = strings.TrimSpace(line)
+	s.mu.Lock()
+	s.calls = append(s.calls, session.Call)
+	s.mu.Unlock()
+	for _, b := range s.Banner {
+		if err := session.Send(strings.ReplaceAll(b, "{call}", session.Call)); err != nil {
+			return
+		}
+	}
+	if s.Script != nil {
+		s.Script(session)
+	}
+}
+
+// Session - One logged in connection, N counts from 1 so scripts can behave differently on reconnect.
+type Session struct {
+	N    int
+	Call string
+	conn net.Conn
+}
+
+// Send writes a line terminated by CRLF, a line that already ends in CRLF is sent as is.
+func (s *Session) Send(line string) error {
+
+	if !strings.HasSuffix(line, "\r\n") {
+		line = strings.TrimSuffix(line, "\n") + "\r\n"
+	}
+	_, err := io.WriteString(s.conn, line)
+	return err
+}
+
+// SendPartial writes text without a line terminator, i.e. to cut a spot off mid line.
+func (s *Session) SendPartial(text string) error {
+
+	_, err := io.WriteString(s.conn, text)
+	return err
+}
+
+// Drop closes the connection abruptly with a reset rather than a normal close.
+func (s *Session) Drop() error {
+
+	if tc, ok := s.conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	return s.conn.Close()
+}
+
+// Lines sends the given lines and returns.
+func Lines(lines ...string) Script {
+
+	return func(s *Session) error {
+		for _, line := range lines {
+			if err := s.Send(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Generate sends n lines made by gen, interval apart, then returns.  The lines are stamped with the
+// time they are sent.
+func Generate(n int, interval time.Duration, gen func(i int, at time.Time) string) Script {
+
+	return func(s *Session) error {
+		for i := 0; i < n; i++ {
+			if i > 0 && interval > 0 {
+				time.Sleep(interval)
+			}
+			if err := s.Send(gen(i, time.Now().UTC())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// FromCapture sends the lines of a capture recorded by the bridge at speed times the original pace,
+// 0 for as fast as possible.  The recorded login prompt is skipped, the server sends its own.
+func FromCapture(path string, speed float64) Script {
+
+	return func(s *Session) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return capture.Read(f, speed, func(line string, at time.Time) error {
+			if strings.Contains(line, Prompt) {
+				return nil
+			}
+			return s.SendPartial(line)
+		})
+	}
+}
+
+// Sequence runs each script in turn on the same connection.
+func Sequence(scripts ...Script) Script {
+
+	return func(s *Session) error {
+		for _, script := range scripts {
+			if err := script(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Disconnect drops the connection abruptly.
+func Disconnect() Script {
+	return func(s *Session) error {
+		return s.Drop()
+	}
+}
+
+// Hold keeps the connection open until the server is closed.
+func Hold() Script {
+
+	return func(s *Session) error {
+		_, err := io.Copy(io.Discard, s.conn)
+		return err
+	}
+}
+
+// Spot formats a spot line the way RBN sends it, i.e.
+// "DX de DK9IP-#:    14025.1  K1ABC          CW    17 dB  25 WPM  CQ      1230Z".
+func Spot(skimmer string, freq float64, dx, mode string, db, wpm int, txMode string, at time.Time) string {
+
+	return fmt.Sprintf("DX de %-10s%9.1f  %-13s  %-5s %2d dB  %2d WPM  %-7s %s",
+		skimmer+"-#:", freq, dx, mode, db, wpm, txMode, at.UTC().Format("1504Z"))
+}
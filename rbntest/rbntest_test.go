@@ -0,0 +1,136 @@
+package rbntest
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.disney.com/guys-workspace/rbn-to-kinesis/capture"
+)
+
+// Log in as call and return everything the server sends until it closes the connection.
+func session(t *testing.T, s *Server, call string) ([]string, error) {
+
+	conn, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	prompt := make([]byte, len(Prompt))
+	if _, err := io.ReadFull(r, prompt); err != nil || string(prompt) != Prompt {
+		t.Fatalf("Expected the login prompt, got %q %v", prompt, err)
+	}
+	io.WriteString(conn, call+"\r\n")
+	b, err := io.ReadAll(r)
+	lines := strings.Split(strings.TrimPrefix(string(b), " "), "\r\n")
+	return lines, err
+}
+
+func TestServerLines(t *testing.T) {
+
+	at := time.Date(2021, 11, 27, 12, 30, 0, 0, time.UTC)
+	spot := Spot("DK9IP", 14025.1, "K1ABC", "CW", 17, 25, "CQ", at)
+	if want := "DX de DK9IP-#:    14025.1  K1ABC          CW    17 dB  25 WPM  CQ      1230Z"; spot != want {
+		t.Errorf("Expected %q, got %q", want, spot)
+	}
+	s := NewServer(Lines(spot, spot))
+	defer s.Close()
+
+	lines, err := session(t, s, "N7ZG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "Hello N7ZG, this is the Reverse Beacon Network test server.", "", "N7ZG de RELAY-TEST >",
+		spot, spot, ""}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("Expected %q, got %q", want, lines)
+	}
+	if calls := s.Calls(); !reflect.DeepEqual(calls, []string{"N7ZG"}) {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+}
+
+func TestServerDisconnect(t *testing.T) {
+
+	s := NewUnstartedServer(func(session *Session) error {
+		if session.N == 1 {
+			session.SendPartial("DX de DK9IP-#:    140")
+			return session.Drop()
+		}
+		return session.Send("second")
+	})
+	s.Banner = nil
+	s.Start()
+	defer s.Close()
+
+	lines, err := session(t, s, "N7ZG")
+	if err == nil {
+		t.Error("Expected the first session to be reset")
+	}
+	if len(lines) != 1 || lines[0] != "DX de DK9IP-#:    140" {
+		t.Errorf("Unexpected first session %q", lines)
+	}
+	if lines, err := session(t, s, "N7ZG"); err != nil || lines[0] != "second" {
+		t.Errorf("Unexpected second session %q %v", lines, err)
+	}
+	if n := s.Sessions(); n != 2 {
+		t.Errorf("Expected 2 sessions, got %d", n)
+	}
+}
+
+func TestServerGenerateAndCapture(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "capture.gz")
+	w, err := capture.NewWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now()
+	w.Record(Prompt, at)
+	w.Record("recorded\r\n", at)
+	w.Close()
+
+	s := NewUnstartedServer(Sequence(
+		Generate(2, 0, func(i int, at time.Time) string { return strings.Repeat("x", i+1) }),
+		FromCapture(path, 0),
+	))
+	s.Banner = nil
+	s.Start()
+	defer s.Close()
+
+	lines, err := session(t, s, "N7ZG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"x", "xx", "recorded", ""}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("Expected %q, got %q", want, lines)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+
+	s := NewServer(Hold())
+	conn, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "N7ZG\r\n")
+	done := make(chan bool)
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return with a session held open")
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/hamba/avro"
+	"gitlab.disney.com/guys-workspace/rbn-to-kinesis/rbntest"
+	_ "modernc.org/sqlite"
+)
+
+// fakeKinesis - In-process Kinesis keeping the records put on each stream.
+type fakeKinesis struct {
+	kinesisiface.KinesisAPI
+	mu      sync.Mutex
+	streams map[string][][]byte
+}
+
+func newFakeKinesis(streams ...string) *fakeKinesis {
+
+	f := &fakeKinesis{streams: make(map[string][][]byte)}
+	for _, s := range streams {
+		f.streams[s] = nil
+	}
+	return f
+}
+
+func (f *fakeKinesis) DescribeStream(in *kinesis.DescribeStreamInput) (*kinesis.DescribeStreamOutput, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.streams[aws.StringValue(in.StreamName)]; !ok {
+		return nil, awserr.New(kinesis.ErrCodeResourceNotFoundException, "stream not found", nil)
+	}
+	return &kinesis.DescribeStreamOutput{StreamDescription: &kinesis.StreamDescription{
+		StreamName: in.StreamName, StreamStatus: aws.String(kinesis.StreamStatusActive)}}, nil
+}
+
+func (f *fakeKinesis) PutRecord(in *kinesis.PutRecordInput) (*kinesis.PutRecordOutput, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := aws.StringValue(in.StreamName)
+	if _, ok := f.streams[name]; !ok {
+		return nil, awserr.New(kinesis.ErrCodeResourceNotFoundException, "stream not found", nil)
+	}
+	f.streams[name] = append(f.streams[name], in.Data)
+	return &kinesis.PutRecordOutput{SequenceNumber: aws.String(fmt.Sprint(len(f.streams[name])))}, nil
+}
+
+// Decoded records on a stream.
+func (f *fakeKinesis) records(t *testing.T, stream string, schema avro.Schema) []map[string]interface{} {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var records []map[string]interface{}
+	for _, data := range f.streams[stream] {
+		var record map[string]interface{}
+		if err := avro.Unmarshal(schema, data, &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+const qrzSession = `<?xml version="1.0" encoding="utf-8" ?>
+<QRZDatabase version="1.34" xmlns="http://xmldata.qrz.com">
+<Session><Key>%s</Key><Count>1</Count><SubExp>non-subscriber</SubExp><Error>%s</Error></Session>
+</QRZDatabase>`
+
+const qrzCallsign = `<?xml version="1.0" encoding="utf-8" ?>
+<QRZDatabase version="1.34" xmlns="http://xmldata.qrz.com">
+<Callsign><call>%s</call><fname>Test</fname><name>Operator</name><state>%s</state><country>United States</country>
+<lat>42.36</lat><lon>-71.06</lon><grid>FN42</grid><land>United States</land><cqzone>5</cqzone><ituzone>8</ituzone></Callsign>
+<Session><Key>test-key</Key><Count>2</Count></Session>
+</QRZDatabase>`
+
+// fakeQRZ - QRZ XML API that knows the calls in states and counts logins and lookups.
+type fakeQRZ struct {
+	states  map[string]string
+	mu      sync.Mutex
+	logins  int
+	lookups []string
+}
+
+func (q *fakeQRZ) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	params := r.URL.Query()
+	if params.Get("username") != "" {
+		q.logins++
+		if params.Get("password") != "test" {
+			fmt.Fprintf(w, qrzSession, "", "Username/password incorrect")
+			return
+		}
+		fmt.Fprintf(w, qrzSession, "test-key", "")
+		return
+	}
+	if params.Get("s") != "test-key" {
+		fmt.Fprintf(w, qrzSession, "", "Session Timeout")
+		return
+	}
+	call := params.Get("callsign")
+	q.lookups = append(q.lookups, call)
+	if state, ok := q.states[call]; ok {
+		fmt.Fprintf(w, qrzCallsign, call, state)
+		return
+	}
+	fmt.Fprintf(w, qrzSession, "test-key", "Not found: "+call)
+}
+
+// harness - The bridge running against a fake RBN, QRZ, Kinesis and an embedded SQLite callsign
+// database.
+type harness struct {
+	t       *testing.T
+	rbn     *rbntest.Server
+	qrz     *fakeQRZ
+	kinesis *fakeKinesis
+	store   CallsignStore
+	db      *sql.DB
+	config  *Config
+	cancel  context.CancelFunc
+	done    chan error
+}
+
+func newHarness(t *testing.T, script rbntest.Script) *harness {
+
+	h := &harness{t: t, qrz: &fakeQRZ{states: map[string]string{"K1ABC": "MA", "W6XYZ": "CA"}},
+		kinesis: newFakeKinesis("spots")}
+	h.rbn = rbntest.NewServer(script)
+	t.Cleanup(h.rbn.Close)
+	qs := httptest.NewServer(h.qrz)
+	t.Cleanup(qs.Close)
+
+	path := filepath.Join(t.TempDir(), "callsign.db")
+	var err error
+	if h.store, err = OpenCallsignStore(DBConfig{Driver: DriverSQLite, File: path}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.store.Close() })
+	// A second connection to check on the bridge
+	if h.db, err = sql.Open("sqlite", path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.db.Close() })
+
+	h.config = DefaultConfig()
+	h.config.Source.RBN.Host, h.config.Source.RBN.Port = h.rbn.HostPort()
+	h.config.Source.RBN.ReconnectDelay = 10 * time.Millisecond
+	h.config.Source.RBN.MaxReconnectDelay = 50 * time.Millisecond
+	h.config.Sinks.Kinesis.Stream = "spots"
+	h.config.Callbook.QRZ.URL = qs.URL
+	h.config.Callbook.QRZ.Username, h.config.Callbook.QRZ.Password = "N7ZG", "test"
+	return h
+}
+
+func (h *harness) start() {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.done = make(chan error, 1)
+	go func() {
+		h.done <- Run(ctx, h.config, Deps{Kinesis: h.kinesis, Store: h.store})
+	}()
+	h.t.Cleanup(h.stop)
+}
+
+// Stop the bridge, Run must return promptly without an error.
+func (h *harness) stop() {
+
+	if h.cancel == nil {
+		return
+	}
+	h.cancel()
+	h.cancel = nil
+	select {
+	case err := <-h.done:
+		if err != nil {
+			h.t.Errorf("Run failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		h.t.Error("Run did not return after cancel")
+	}
+}
+
+// Wait for n records on the spots stream.
+func (h *harness) wait(n int) []map[string]interface{} {
+	return h.waitStream("spots", SpotSchema, n)
+}
+
+func TestRunPublishesSpots(t *testing.T) {
+
+	now := time.Now().UTC()
+	h := newHarness(t, rbntest.Sequence(
+		rbntest.Lines(
+			rbntest.Spot("DK9IP", 14025.1, "K1ABC", "CW", 17, 25, "CQ", now),
+			"Local spots are not sent to this port.",
+			rbntest.Spot("DK9IP", 7025.3, "W6XYZ", "CW", 9, 22, "CQ", now),
+		),
+		rbntest.Hold(),
+	))
+	h.start()
+
+	records := h.wait(2)
+	h.stop()
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	want := []map[string]interface{}{
+		{"callsign": "DK9IP", "de_pfx": "DL", "de_cont": "EU", "dx": "K1ABC", "dx_pfx": "K", "dx_cont": "NA",
+			"dx_state": "MA", "band": "20m", "freq": 14025.1, "freq_hz": int64(14025100), "mode": "CW", "tx_mode": "CQ",
+			"db": 17, "speed": 25, "segment": "cw", "out_of_band": false, "in_scp": false},
+		{"dx": "W6XYZ", "dx_state": "CA", "band": "40m", "freq": 7025.3, "db": 9, "speed": 22},
+	}
+	for i, fields := range want {
+		for k, v := range fields {
+			if records[i][k] != v {
+				t.Errorf("Record %d: expected %s %v (%T), got %v (%T)", i, k, v, v, records[i][k], records[i][k])
+			}
+		}
+	}
+	spotMinute := now.Truncate(time.Minute).UnixNano() / int64(time.Millisecond)
+	if d := records[0]["date"].(int64); d != spotMinute {
+		t.Errorf("Expected date %d, got %d", spotMinute, d)
+	}
+
+	if calls := h.rbn.Calls(); len(calls) != 1 || calls[0] != "N7ZG" {
+		t.Errorf("Unexpected logins %v", calls)
+	}
+	if h.qrz.logins != 1 {
+		t.Errorf("Expected 1 QRZ login, got %d", h.qrz.logins)
+	}
+	// QRZ results are stored, the skimmer is not found
+	var n int
+	if err := h.db.QueryRow("select count(*) from callsign where call in ('K1ABC', 'W6XYZ')").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 callsign rows, got %d", n)
+	}
+}
+
+func TestRunUsesCallsignDatabase(t *testing.T) {
+
+	now := time.Now().UTC()
+	h := newHarness(t, rbntest.Sequence(
+		rbntest.Lines(rbntest.Spot("DK9IP", 14025.1, "N1XX", "CW", 17, 25, "CQ", now)),
+		rbntest.Hold(),
+	))
+	if _, err := h.db.Exec("insert into callsign (call, state) values ('N1XX', 'VT')"); err != nil {
+		t.Fatal(err)
+	}
+	h.start()
+
+	records := h.wait(1)
+	h.stop()
+	if records[0]["dx_state"] != "VT" {
+		t.Errorf("Expected the state on file, got %v", records[0]["dx_state"])
+	}
+	for _, call := range h.qrz.lookups {
+		if call == "N1XX" {
+			t.Error("Call on file was looked up on QRZ")
+		}
+	}
+}
+
+func TestRunUsesCallsignDatabaseWithSCP(t *testing.T) {
+
+	now := time.Now().UTC()
+	h := newHarness(t, rbntest.Sequence(
+		rbntest.Lines(
+			rbntest.Spot("DK9IP", 14025.1, "N1XX", "CW", 17, 25, "CQ", now),
+			rbntest.Spot("DK9IP", 7025.3, "W6XYZ", "CW", 9, 22, "CQ", now),
+		),
+		rbntest.Hold(),
+	))
+	if _, err := h.db.Exec("insert into callsign (call, state) values ('N1XX', 'VT')"); err != nil {
+		t.Fatal(err)
+	}
+	// Neither call is on the list, N1XX is still resolved from the local DB
+	h.config.Callbook.SCP.File = filepath.Join(t.TempDir(), "MASTER.SCP")
+	if err := ioutil.WriteFile(h.config.Callbook.SCP.File, []byte("K1ABC\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The reload loop has to stop for Run to return
+	h.config.Callbook.SCP.ReloadInterval = 10 * time.Millisecond
+	h.start()
+
+	records := h.wait(2)
+	h.stop()
+	if records[0]["dx_state"] != "VT" || records[0]["in_scp"] != false {
+		t.Errorf("Expected the state on file, got %v", records[0])
+	}
+	for _, call := range h.qrz.lookups {
+		if call == "N1XX" || call == "W6XYZ" {
+			t.Errorf("%s was looked up on QRZ", call)
+		}
+	}
+}
+
+func TestRunReconnects(t *testing.T) {
+
+	now := time.Now().UTC()
+	h := newHarness(t, func(s *rbntest.Session) error {
+		switch s.N {
+		case 1:
+			// Cut off mid spot
+			s.Send(rbntest.Spot("DK9IP", 14025.1, "K1ABC", "CW", 17, 25, "CQ", now))
+			s.SendPartial("DX de DK9IP-#:    140")
+			return s.Drop()
+		case 2:
+			// Dropped right after the banner
+			return s.Drop()
+		}
+		s.Send(rbntest.Spot("DK9IP", 7025.3, "W6XYZ", "CW", 9, 22, "CQ", now))
+		return rbntest.Hold()(s)
+	})
+	h.start()
+
+	records := h.wait(2)
+	h.stop()
+	if len(records) != 2 || records[0]["dx"] != "K1ABC" || records[1]["dx"] != "W6XYZ" {
+		t.Errorf("Unexpected records %v", records)
+	}
+	if n := h.rbn.Sessions(); n != 3 {
+		t.Errorf("Expected 3 sessions, got %d", n)
+	}
+}
+
+// Wait for n records decoded with schema on a stream.
+func (h *harness) waitStream(stream, schema string, n int) []map[string]interface{} {
+
+	s := avro.MustParse(schema)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		records := h.kinesis.records(h.t, stream, s)
+		if len(records) >= n {
+			return records
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatalf("Expected %d records on %s, got %d", n, stream, len(records))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunFlushesIdleAggregates(t *testing.T) {
+
+	now := time.Now().UTC()
+	h := newHarness(t, rbntest.Sequence(
+		rbntest.Lines(
+			rbntest.Spot("DK9IP", 14025.1, "K1ABC", "CW", 17, 25, "CQ", now),
+			rbntest.Spot("W3LPL", 14025.2, "K1ABC", "CW", 23, 25, "CQ", now),
+		),
+		rbntest.Hold(),
+	))
+	h.config.Aggregate.Enabled = true
+	h.config.Aggregate.Window = 50 * time.Millisecond
+	h.start()
+
+	// No further spots arrive, the ticker publishes the closed window
+	events := h.waitStream("spots", DxHeardSchema, 1)
+	h.stop()
+	if len(events) != 1 || events[0]["dx"] != "K1ABC" || events[0]["skimmers"] != 2 {
+		t.Errorf("Unexpected events %v", events)
+	}
+}
+
+func TestRunFlushesOpenAggregatesOnStop(t *testing.T) {
+
+	now := time.Now().UTC()
+	h := newHarness(t, rbntest.Sequence(
+		rbntest.Lines(rbntest.Spot("DK9IP", 14025.1, "K1ABC", "CW", 17, 25, "CQ", now)),
+		rbntest.Hold(),
+	))
+	h.kinesis = newFakeKinesis("spots", "raw")
+	h.config.Aggregate.Enabled = true
+	h.config.Aggregate.Window = time.Hour
+	h.config.Sinks.Kinesis.RawStream = "raw"
+	h.start()
+
+	h.waitStream("raw", SpotSchema, 1)
+	if events := h.kinesis.records(t, "spots", avro.MustParse(DxHeardSchema)); len(events) != 0 {
+		t.Errorf("Expected the window to stay open, got %v", events)
+	}
+	h.stop()
+	events := h.kinesis.records(t, "spots", avro.MustParse(DxHeardSchema))
+	if len(events) != 1 || events[0]["dx"] != "K1ABC" {
+		t.Errorf("Expected the open window published on stop, got %v", events)
+	}
+}
+
+// failingStore - Callsign database that is down.
+type failingStore struct{}
+
+func (failingStore) Get(call string) (map[string]interface{}, error) {
+	return nil, errors.New("database down")
+}
+
+func (failingStore) Insert(*QRZDatabase) error { return errors.New("database down") }
+
+func (failingStore) Close() error { return nil }
+
+func TestRunReturnsDatabaseErrors(t *testing.T) {
+
+	now := time.Now().UTC()
+	h := newHarness(t, rbntest.Sequence(
+		rbntest.Lines(rbntest.Spot("DK9IP", 14025.1, "K1ABC", "CW", 17, 25, "CQ", now)),
+		rbntest.Hold(),
+	))
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(context.Background(), h.config, Deps{Kinesis: h.kinesis, Store: failingStore{}})
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "database down") {
+			t.Errorf("Expected the database error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return the database error")
+	}
+	if records := h.kinesis.records(t, "spots", avro.MustParse(SpotSchema)); len(records) != 0 {
+		t.Errorf("Expected nothing published, got %v", records)
+	}
+}
+
+func TestRunReturnsQRZLoginErrors(t *testing.T) {
+
+	now := time.Now().UTC()
+	h := newHarness(t, rbntest.Sequence(
+		rbntest.Lines(rbntest.Spot("DK9IP", 14025.1, "K1ABC", "CW", 17, 25, "CQ", now)),
+		rbntest.Hold(),
+	))
+	h.config.Callbook.QRZ.Password = "wrong"
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(context.Background(), h.config, Deps{Kinesis: h.kinesis, Store: h.store})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errQRZLogin) || !strings.Contains(err.Error(), "Username/password incorrect") {
+			t.Errorf("Expected the QRZ login error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return the QRZ login error")
+	}
+}
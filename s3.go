@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3Uploader - Uploads finished files from a local spool directory to Bucket under Prefix, keyed
+// by their path relative to the spool.  Files are removed from the spool once uploaded, so uploads
+// still pending when the process stops are picked up on the next start.  Large files are sent as
+// multipart uploads, failed uploads are retried with exponential backoff and then left for the
+// next pass.
+type S3Uploader struct {
+	Bucket   string
+	Prefix   string
+	Spool    string
+	Retries  int
+	Backoff  time.Duration
+	Interval time.Duration
+	uploader *s3manager.Uploader
+	kick     chan struct{}
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewS3Uploader creates the spool directory, Start begins uploading.
+func NewS3Uploader(client s3iface.S3API, bucket, prefix, spool string, partSize int64) (*S3Uploader, error) {
+
+	if err := os.MkdirAll(spool, 0755); err != nil {
+		return nil, err
+	}
+	u := &S3Uploader{Bucket: bucket, Prefix: strings.Trim(prefix, "/"), Spool: spool, Retries: 3,
+		Backoff: time.Second, Interval: time.Minute, kick: make(chan struct{}, 1), stop: make(chan struct{})}
+	u.uploader = s3manager.NewUploaderWithClient(client, func(up *s3manager.Uploader) {
+		if partSize > up.PartSize {
+			up.PartSize = partSize
+		}
+	})
+	return u, nil
+}
+
+// Start uploads in the background, first whatever was left in the spool by a previous run.
+func (u *S3Uploader) Start() {
+
+	u.wg.Add(1)
+	go u.run()
+}
+
+// Notify wakes the uploader after a file has been added to the spool.
+func (u *S3Uploader) Notify(path string) {
+
+	select {
+	case u.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (u *S3Uploader) run() {
+
+	defer u.wg.Done()
+	t := time.NewTicker(u.Interval)
+	defer t.Stop()
+	u.UploadPending()
+	for {
+		select {
+		case <-u.stop:
+			return
+		case <-u.kick:
+		case <-t.C:
+		}
+		u.UploadPending()
+	}
+}
+
+// UploadPending uploads every finished file in the spool and returns how many are left.
+func (u *S3Uploader) UploadPending() int {
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	left := 0
+	filepath.Walk(u.Spool, func(path string, info os.FileInfo, err error) error {
+		// Dot files are still being written
+		if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		if err := u.upload(path); err != nil {
+			log.Printf("S3 upload of %s failed: %v", path, err)
+			left++
+			return nil
+		}
+		os.Remove(path)
+		return nil
+	})
+	return left
+}
+
+func (u *S3Uploader) upload(path string) error {
+
+	rel, err := filepath.Rel(u.Spool, path)
+	if err != nil {
+		return err
+	}
+	key := filepath.ToSlash(rel)
+	if u.Prefix != "" {
+		key = u.Prefix + "/" + key
+	}
+	backoff := u.Backoff
+	for attempt := 0; ; attempt++ {
+		err = u.put(path, key)
+		if err == nil || attempt >= u.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (u *S3Uploader) put(path, key string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = u.uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(u.Bucket),
+		Key:    aws.String(key),
+		Body:   f,
+	})
+	return err
+}
+
+// Close stops the background uploader and makes a last pass over the spool.
+func (u *S3Uploader) Close() error {
+
+	close(u.stop)
+	u.wg.Wait()
+	if left := u.UploadPending(); left > 0 {
+		return fmt.Errorf("%d files left in spool %s", left, u.Spool)
+	}
+	return nil
+}
+
+// S3Sink - Batches records into files in a spool directory and uploads them to S3 under Hive style
+// <record>/year=YYYY/month=MM/day=DD/hour=HH/ prefixes.
+type S3Sink struct {
+	*FileSink
+	Uploader *S3Uploader
+}
+
+// NewS3Sink writes format (avro, parquet or ndjson) files of up to maxBytes or an hour of spots.
+func NewS3Sink(client s3iface.S3API, c S3Config) (*S3Sink, error) {
+
+	uploader, err := NewS3Uploader(client, c.Bucket, c.Prefix, c.SpoolDir, c.PartSize)
+	if err != nil {
+		return nil, err
+	}
+	files, err := NewFileSink(c.SpoolDir, c.Format, c.MaxBytes, time.Hour, hivePartition)
+	if err != nil {
+		uploader.Close()
+		return nil, err
+	}
+	files.Done = uploader.Notify
+	uploader.Start()
+	return &S3Sink{FileSink: files, Uploader: uploader}, nil
+}
+
+// Close finishes the open files and uploads everything left in the spool.
+func (s *S3Sink) Close() error {
+
+	err := s.FileSink.Close()
+	if uerr := s.Uploader.Close(); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// <record>/year=YYYY/month=MM/day=DD/hour=HH
+func hivePartition(name string, record map[string]interface{}, at time.Time) string {
+	return filepath.Join(name, at.Format("year=2006"), at.Format("month=01"), at.Format("day=02"), at.Format("hour=15"))
+}
+
+// NewS3Client connects to AWS or, with an endpoint, an S3 compatible store such as MinIO.
+func NewS3Client(c S3Config) (*s3.S3, error) {
+
+	cfg := &aws.Config{Region: aws.String(c.Region)}
+	if c.Endpoint != "" {
+		cfg.Endpoint = aws.String(c.Endpoint)
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(sess), nil
+}
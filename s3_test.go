@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hamba/avro"
+	"github.com/hamba/avro/ocf"
+)
+
+// fakeS3 - Just enough of the S3 API (path style put object and multipart upload) to stand in for
+// MinIO.  The first fail requests are answered with a 500.
+type fakeS3 struct {
+	mu        sync.Mutex
+	objects   map[string][]byte
+	parts     map[string]map[int][]byte
+	multipart int
+	fail      int
+}
+
+func newFakeS3() (*fakeS3, *httptest.Server) {
+
+	f := &fakeS3{objects: make(map[string][]byte), parts: make(map[string]map[int][]byte)}
+	return f, httptest.NewServer(f)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail > 0 {
+		f.fail--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	q := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+	_, initiate := q["uploads"]
+	id := q.Get("uploadId")
+	switch {
+	case r.Method == http.MethodPost && initiate:
+		f.multipart++
+		id = strconv.Itoa(f.multipart)
+		f.parts[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", key, id)
+	case r.Method == http.MethodPut && id != "":
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.parts[id][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%s-%d"`, id, n))
+	case r.Method == http.MethodPost && id != "":
+		var nums []int
+		for n := range f.parts[id] {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		var obj []byte
+		for _, n := range nums {
+			obj = append(obj, f.parts[id][n]...)
+		}
+		f.objects[key] = obj
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key><ETag>\"%s\"</ETag></CompleteMultipartUploadResult>", key, id)
+	case r.Method == http.MethodDelete && id != "":
+		delete(f.parts, id)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (f *fakeS3) keys() []string {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// S3 client without SDK retries so the uploader's own retries are exercised.
+func testS3Client(url string) *s3.S3 {
+
+	return s3.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(url),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+		MaxRetries:       aws.Int(0),
+	})))
+}
+
+func TestS3Sink(t *testing.T) {
+
+	for _, format := range []string{FormatAvro, FormatNDJSON, FormatParquet} {
+		fake, ts := newFakeS3()
+		sink, err := NewS3Sink(testS3Client(ts.URL), S3Config{Bucket: "spots", Prefix: "rbn", Format: format,
+			SpoolDir: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema := avro.MustParse(SpotSchema)
+		at := time.Date(2021, 10, 13, 12, 30, 0, 0, time.UTC)
+		for i, dx := range []string{"K1ABC", "K1ABD", "K1ABE"} {
+			if err := sink.Publish(schema, testSpot(dx, "20m", 14025.1, at.Add(time.Duration(i)*time.Minute)), at); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ts.Close()
+
+		keys := fake.keys()
+		if len(keys) != 1 {
+			t.Fatalf("%s: expected 1 object, got %v", format, keys)
+		}
+		prefix := "spots/rbn/spot_events/year=2021/month=10/day=13/hour=12/"
+		if !strings.HasPrefix(keys[0], prefix) || !strings.HasSuffix(keys[0], formatExt(format)) {
+			t.Errorf("%s: unexpected key %s", format, keys[0])
+		}
+		obj := fake.objects[keys[0]]
+		switch format {
+		case FormatAvro:
+			dec, err := ocf.NewDecoder(bytes.NewReader(obj))
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := 0
+			for dec.HasNext() {
+				var r map[string]interface{}
+				if err := dec.Decode(&r); err != nil {
+					t.Fatal(err)
+				}
+				n++
+			}
+			if n != 3 {
+				t.Errorf("Decoded %d avro records, want 3", n)
+			}
+		case FormatNDJSON:
+			gz, err := gzip.NewReader(bytes.NewReader(obj))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec := json.NewDecoder(gz)
+			var dxs []string
+			for dec.More() {
+				var r map[string]interface{}
+				if err := dec.Decode(&r); err != nil {
+					t.Fatal(err)
+				}
+				dxs = append(dxs, r["dx"].(string))
+			}
+			if strings.Join(dxs, ",") != "K1ABC,K1ABD,K1ABE" {
+				t.Errorf("Decoded %v", dxs)
+			}
+		case FormatParquet:
+			if !bytes.HasPrefix(obj, []byte("PAR1")) || !bytes.HasSuffix(obj, []byte("PAR1")) {
+				t.Errorf("Not a parquet file")
+			}
+		}
+	}
+}
+
+func TestS3Multipart(t *testing.T) {
+
+	fake, ts := newFakeS3()
+	defer ts.Close()
+	spool := t.TempDir()
+	data := make([]byte, 12*1024*1024)
+	rand.Read(data)
+	os.MkdirAll(filepath.Join(spool, "a"), 0755)
+	ioutil.WriteFile(filepath.Join(spool, "a", "big.avro"), data, 0644)
+
+	u, err := NewS3Uploader(testS3Client(ts.URL), "spots", "", spool, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Start()
+	if err := u.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fake.multipart != 1 {
+		t.Errorf("Expected a multipart upload, got %d", fake.multipart)
+	}
+	if !bytes.Equal(fake.objects["spots/a/big.avro"], data) {
+		t.Errorf("Multipart object doesn't match")
+	}
+	if _, err := os.Stat(filepath.Join(spool, "a", "big.avro")); !os.IsNotExist(err) {
+		t.Errorf("Uploaded file should be removed from the spool")
+	}
+}
+
+func TestS3RetryAndSpool(t *testing.T) {
+
+	fake, ts := newFakeS3()
+	defer ts.Close()
+	spool := t.TempDir()
+	ioutil.WriteFile(filepath.Join(spool, "one.ndjson.gz"), []byte("one"), 0644)
+
+	// Fails more often than it retries so the file stays in the spool
+	fake.fail = 100
+	u, err := NewS3Uploader(testS3Client(ts.URL), "spots", "", spool, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Backoff = time.Millisecond
+	u.Start()
+	if err := u.Close(); err == nil {
+		t.Errorf("Close should report files left in the spool")
+	}
+	if _, err := os.Stat(filepath.Join(spool, "one.ndjson.gz")); err != nil {
+		t.Errorf("Failed upload should stay in the spool: %v", err)
+	}
+
+	// A transient failure is retried, a new uploader picks up what was left behind
+	fake.mu.Lock()
+	fake.fail = 1
+	fake.mu.Unlock()
+	u, err = NewS3Uploader(testS3Client(ts.URL), "spots", "", spool, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Backoff = time.Millisecond
+	u.Start()
+	if err := u.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if string(fake.objects["spots/one.ndjson.gz"]) != "one" {
+		t.Errorf("Spooled file not uploaded, have %v", fake.keys())
+	}
+}
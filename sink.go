@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/hamba/avro"
+)
+
+// Sink - Destination for decorated spots and dx_heard events.  at is the spot time, used for
+// partitioning.  Flush makes everything published so far durable, Close flushes and releases the
+// sink.
+type Sink interface {
+	Publish(schema avro.Schema, record map[string]interface{}, at time.Time) error
+	Flush() error
+	Close() error
+}
+
+// MultiSink - Publishes to every sink in turn.
+type MultiSink []Sink
+
+// Publish stops at the first sink that fails.
+func (ms MultiSink) Publish(schema avro.Schema, record map[string]interface{}, at time.Time) error {
+
+	for _, s := range ms {
+		if err := s.Publish(schema, record, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush stops at the first sink that fails.
+func (ms MultiSink) Flush() error {
+
+	for _, s := range ms {
+		if err := s.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every sink, returning the first error.
+func (ms MultiSink) Close() error {
+
+	var first error
+	for _, s := range ms {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// KinesisSink - Publishes Avro encoded records to a Kinesis stream, partitioned by time.
+type KinesisSink struct {
+	Client kinesisiface.KinesisAPI
+	Stream string
+}
+
+// NewKinesisSink checks that the stream exists.
+func NewKinesisSink(client kinesisiface.KinesisAPI, stream string) (*KinesisSink, error) {
+
+	_, err := client.DescribeStream(&kinesis.DescribeStreamInput{StreamName: aws.String(stream)})
+	if err != nil {
+		return nil, fmt.Errorf("cannot describe stream %s: %v", stream, err)
+	}
+	return &KinesisSink{Client: client, Stream: stream}, nil
+}
+
+// Publish encodes the record and puts it on the stream.
+func (k *KinesisSink) Publish(schema avro.Schema, record map[string]interface{}, at time.Time) error {
+
+	data, err := avro.Marshal(schema, record)
+	if err != nil {
+		return err
+	}
+	_, err = k.Client.PutRecord(&kinesis.PutRecordInput{
+		Data:         data,
+		StreamName:   aws.String(k.Stream),
+		PartitionKey: aws.String(at.Format(time.RFC3339)),
+	})
+	return err
+}
+
+// Flush is a no-op, records are put synchronously.
+func (k *KinesisSink) Flush() error {
+	return nil
+}
+
+// Close is a no-op, records are put synchronously.
+func (k *KinesisSink) Close() error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+)
+
+// Columns (sql tags) and values of the tagged fields of the struct v points to, in field order.
+func sqlColumns(v interface{}) ([]string, []interface{}) {
+
+	var cols []string
+	var vals []interface{}
+	rv := reflect.ValueOf(v).Elem()
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if col := t.Field(i).Tag.Get("sql"); col != "" {
+			cols = append(cols, col)
+			vals = append(vals, rv.Field(i).Interface())
+		}
+	}
+	return cols, vals
+}
+
+// Values of the sql tagged fields of v, in the column order of sqlColumns.
+func bindParams(v interface{}) []interface{} {
+
+	_, vals := sqlColumns(v)
+	return vals
+}
+
+// Every row as a map of column name to value.  Drivers return text columns as []byte, those
+// come back as strings.
+func allRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+
+	if rows == nil {
+		return nil, nil
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var ret []map[string]interface{}
+	for rows.Next() {
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			if b, ok := vals[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = vals[i]
+			}
+		}
+		ret = append(ret, row)
+	}
+	return ret, rows.Err()
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Callsign database drivers.
+const (
+	DriverQuanta   = "quanta"
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// CallsignStore - Callsign table caching QRZ lookups, so each call is only looked up once.
+type CallsignStore interface {
+	// Get returns the row of call, or of the call that lists it as an alias, nil if there's neither.
+	Get(call string) (map[string]interface{}, error)
+	// Insert adds a QRZ lookup result.
+	Insert(qrz *QRZDatabase) error
+	Close() error
+}
+
+// OpenCallsignStore connects to the configured database and, unless SkipMigrations is set, brings
+// its schema up to date.
+func OpenCallsignStore(c DBConfig) (CallsignStore, error) {
+
+	db, d, err := openCallsignDB(c)
+	if err != nil {
+		return nil, err
+	}
+	if !c.SkipMigrations {
+		applied, err := migrate(db, d, false)
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%s.", m.Version, m.Name)
+		}
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return newSQLStore(db, d)
+}
+
+// Connection pool and dialect of the configured driver.
+func openCallsignDB(c DBConfig) (*sql.DB, dialect, error) {
+
+	switch c.Driver {
+	case DriverQuanta, "":
+		return openQuanta(c)
+	case DriverMySQL:
+		return openMySQL(c)
+	case DriverPostgres:
+		return openPostgres(c)
+	case DriverSQLite:
+		return openSQLite(c)
+	}
+	return nil, dialect{}, fmt.Errorf("unknown db driver '%s'", c.Driver)
+}
+
+// dialect - What differs between the SQL databases the callsign table can live in.
+type dialect struct {
+	// Quote an identifier
+	quote func(name string) string
+	// Placeholder of bind parameter n, counting from 1
+	param func(n int) string
+	// Directory of its migrations, empty if the database manages its own schema (Quanta)
+	migrations string
+	// Value to insert into column col for v, nil binds the field values as they are
+	bind func(col string, v interface{}) interface{}
+}
+
+// Unquoted identifiers and ? placeholders.
+var plainDialect = dialect{
+	quote: func(name string) string { return name },
+	param: func(int) string { return "?" },
+}
+
+// SQLStore - CallsignStore over database/sql, shared by the MySQL/Quanta, Postgres and SQLite stores.
+type SQLStore struct {
+	db         *sql.DB
+	dialect    dialect
+	cols       []string
+	selectStmt *sql.Stmt
+	aliasStmt  *sql.Stmt
+	insertStmt *sql.Stmt
+}
+
+// Prepare the statements, db is closed on error.
+func newSQLStore(db *sql.DB, d dialect) (*SQLStore, error) {
+
+	cols, _ := sqlColumns(&QRZDatabase{})
+	s := &SQLStore{db: db, dialect: d, cols: cols}
+	quoted := make([]string, len(cols))
+	params := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = d.quote(col)
+		params[i] = d.param(i + 1)
+	}
+	table, call, aliases := d.quote("callsign"), d.quote("call"), d.quote("aliases")
+	var err error
+	if s.selectStmt, err = db.Prepare(fmt.Sprintf("select * from %s where %s = %s", table, call,
+		d.param(1))); err == nil {
+		if s.aliasStmt, err = db.Prepare(fmt.Sprintf("select * from %s where %s like %s", table, aliases,
+			d.param(1))); err == nil {
+			s.insertStmt, err = db.Prepare(fmt.Sprintf("insert into %s (%s) values (%s)", table,
+				strings.Join(quoted, ", "), strings.Join(params, ", ")))
+		}
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get looks the call up, then among the aliases.
+func (s *SQLStore) Get(call string) (map[string]interface{}, error) {
+
+	call = strings.TrimSpace(call)
+	rows, err := s.query(s.selectStmt, call)
+	if err != nil || len(rows) > 0 {
+		if len(rows) > 0 {
+			return rows[0], nil
+		}
+		return nil, err
+	}
+	if rows, err = s.query(s.aliasStmt, "%"+call+"%"); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		// like also matches calls that contain this one, i.e. K1ABCD for K1ABC
+		aliases, _ := row["aliases"].(string)
+		for _, alias := range strings.Split(aliases, ",") {
+			if strings.TrimSpace(alias) == call {
+				return row, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (s *SQLStore) query(stmt *sql.Stmt, arg string) ([]map[string]interface{}, error) {
+
+	rows, err := stmt.Query(arg)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return allRows(rows)
+}
+
+// Insert adds the sql tagged fields of the QRZ result.
+func (s *SQLStore) Insert(qrz *QRZDatabase) error {
+
+	vals := bindParams(qrz)
+	if s.dialect.bind != nil {
+		for i, v := range vals {
+			vals[i] = s.dialect.bind(s.cols[i], v)
+		}
+	}
+	_, err := s.insertStmt.Exec(vals...)
+	return err
+}
+
+// Close releases the statements and the connection pool.
+func (s *SQLStore) Close() error {
+
+	for _, stmt := range []*sql.Stmt{s.selectStmt, s.aliasStmt, s.insertStmt} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Quanta through its MySQL protocol proxy.  Quanta tables are defined in its own schema
+// configuration and managed by hand, so there are no migrations and the callsign table must already
+// exist there.  Its columns are text as QRZ sends it, so the typed fields are bound as text.
+func openQuanta(c DBConfig) (*sql.DB, dialect, error) {
+
+	db, err := sql.Open("mysql", mysqlDSN(c))
+	d := plainDialect
+	d.bind = quantaValue
+	return db, d, err
+}
+
+// QRZ flags are 1/0 except DST, which is Y/N.
+var quantaFlags = map[string][2]string{"dst": {"Y", "N"}}
+
+// Text of a typed QRZ field as QRZ sends it, empty if unknown.
+func quantaValue(col string, v interface{}) interface{} {
+
+	switch v := v.(type) {
+	case sql.NullInt64:
+		if v.Valid {
+			return strconv.FormatInt(v.Int64, 10)
+		}
+	case sql.NullFloat64:
+		if v.Valid {
+			return strconv.FormatFloat(v.Float64, 'f', -1, 64)
+		}
+	case sql.NullTime:
+		if v.Valid {
+			if v.Time.Equal(v.Time.Truncate(24 * time.Hour)) {
+				return v.Time.Format("2006-01-02")
+			}
+			return v.Time.Format("2006-01-02 15:04:05")
+		}
+	case sql.NullBool:
+		if v.Valid {
+			flag, ok := quantaFlags[col]
+			if !ok {
+				flag = [2]string{"1", "0"}
+			}
+			if v.Bool {
+				return flag[0]
+			}
+			return flag[1]
+		}
+	default:
+		return v
+	}
+	return ""
+}
+
+// MySQL or MariaDB.
+func openMySQL(c DBConfig) (*sql.DB, dialect, error) {
+
+	db, err := sql.Open("mysql", mysqlDSN(c))
+	// call is a reserved word in MySQL
+	d := plainDialect
+	d.quote = func(name string) string { return "`" + name + "`" }
+	d.migrations = DriverMySQL
+	return db, d, err
+}
+
+// DSN from the config, escaping the password, unless one is given.
+func mysqlDSN(c DBConfig) string {
+
+	if c.DSN != "" {
+		return c.DSN
+	}
+	mc := mysql.NewConfig()
+	mc.User = c.User
+	mc.Passwd = c.Password
+	mc.Net = "tcp"
+	mc.Addr = c.HostPort
+	mc.DBName = c.Schema
+	return mc.FormatDSN()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgreSQL, which numbers its bind parameters.
+func openPostgres(c DBConfig) (*sql.DB, dialect, error) {
+
+	db, err := sql.Open("postgres", postgresDSN(c))
+	d := dialect{
+		quote:      func(name string) string { return `"` + name + `"` },
+		param:      func(n int) string { return fmt.Sprintf("$%d", n) },
+		migrations: DriverPostgres,
+	}
+	return db, d, err
+}
+
+// URL from the config, Schema names the database, unless a DSN is given.
+func postgresDSN(c DBConfig) string {
+
+	if c.DSN != "" {
+		return c.DSN
+	}
+	u := url.URL{Scheme: "postgres", User: url.UserPassword(c.User, c.Password), Host: c.HostPort,
+		Path: "/" + c.Schema}
+	return u.String()
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"database/sql"
+
+	_ "modernc.org/sqlite"
+)
+
+// Embedded SQLite database file, created if missing, so the bridge runs without a database server.
+func openSQLite(c DBConfig) (*sql.DB, dialect, error) {
+
+	dsn := c.DSN
+	if dsn == "" {
+		// Wait out another connection's write rather than failing with SQLITE_BUSY
+		dsn = c.File + "?_pragma=busy_timeout(5000)"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	d := plainDialect
+	d.quote = func(name string) string { return `"` + name + `"` }
+	d.migrations = DriverSQLite
+	return db, d, err
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/xml"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteStore(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "callsign.db")
+	store, err := OpenCallsignStore(DBConfig{Driver: DriverSQLite, File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row, err := store.Get("K1ABC"); err != nil || row != nil {
+		t.Errorf("Expected no row in an empty table, got %v %v", row, err)
+	}
+	if err := store.Insert(&QRZDatabase{Call: "K1ABC", Aliases: "KB1ABC,K1ABCD/M", State: "MA"}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Reopening keeps the table and its rows
+	if store, err = OpenCallsignStore(DBConfig{Driver: DriverSQLite, File: path}); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for _, tc := range []struct {
+		call, want string
+	}{
+		{"K1ABC", "K1ABC"},
+		{" K1ABC ", "K1ABC"},
+		{"KB1ABC", "K1ABC"},
+		{"K1AB", ""},
+		{"B1ABC", ""},
+	} {
+		row, err := store.Get(tc.call)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if row != nil {
+			got, _ = row["call"].(string)
+			// Unknown QRZ values are stored as NULL
+			if row["state"] != "MA" || row["lat"] != nil || row["lotw"] != nil || row["license_exp_date"] != nil {
+				t.Errorf("%s: unexpected row %v", tc.call, row)
+			}
+		}
+		if got != tc.want {
+			t.Errorf("%q: expected %q, got %q", tc.call, tc.want, got)
+		}
+	}
+}
+
+func TestStoreDSN(t *testing.T) {
+
+	c := DBConfig{HostPort: "db:3306", User: "rbn", Password: "p@ss:word", Schema: "ham"}
+	if dsn := mysqlDSN(c); dsn != "rbn:p@ss:word@tcp(db:3306)/ham" {
+		t.Errorf("Unexpected MySQL DSN %s", dsn)
+	}
+	c.HostPort = "db:5432"
+	if dsn := postgresDSN(c); dsn != "postgres://rbn:p%40ss%3Aword@db:5432/ham" {
+		t.Errorf("Unexpected Postgres DSN %s", dsn)
+	}
+	c.DSN = "postgres://other"
+	if dsn := postgresDSN(c); dsn != c.DSN {
+		t.Errorf("Expected the DSN as given, got %s", dsn)
+	}
+	if _, err := OpenCallsignStore(DBConfig{Driver: "oracle"}); err == nil {
+		t.Error("Expected an error for an unknown driver")
+	}
+}
+
+func TestQuantaValues(t *testing.T) {
+
+	var qrz QRZDatabase
+	if err := xml.Unmarshal([]byte(`<QRZDatabase><Callsign><call>K1ABC</call><dxcc>291</dxcc><lat>42.36</lat>
+<lon></lon><expdate>2031-05-01</expdate><efdate>0000-00-00</efdate><moddate>2021-10-12 18:04:05</moddate>
+<DST>Y</DST><eqsl>0</eqsl><lotw>1</lotw></Callsign></QRZDatabase>`), &qrz); err != nil {
+		t.Fatal(err)
+	}
+	cols, vals := sqlColumns(&qrz)
+	got := make(map[string]interface{}, len(cols))
+	for i, col := range cols {
+		got[col] = quantaValue(col, vals[i])
+	}
+	for col, want := range map[string]string{"call": "K1ABC", "dxcc_id": "291", "lat": "42.36", "lon": "",
+		"license_exp_date": "2031-05-01", "license_issue_date": "", "mod_date": "2021-10-12 18:04:05",
+		"dst": "Y", "eqsl": "0", "lotw": "1", "mqsl": "", "born": ""} {
+		if got[col] != want {
+			t.Errorf("%s: expected %q, got %v", col, want, got[col])
+		}
+	}
+}